@@ -0,0 +1,119 @@
+package nzbparser
+
+import (
+	"time"
+)
+
+// builder to construct nzb files programmatically
+type Builder struct {
+	comment string
+	meta    map[string]string
+	files   []*FileBuilder
+}
+
+// builder for a single file of the nzb, created by Builder.AddFile
+type FileBuilder struct {
+	file NzbFile
+}
+
+// create a new nzb builder
+func NewBuilder() *Builder {
+	return &Builder{
+		meta: make(map[string]string),
+	}
+}
+
+// set the meta data value for the given type
+func (b *Builder) SetMeta(key, value string) *Builder {
+	b.meta[key] = value
+	return b
+}
+
+// set the comment of the nzb
+func (b *Builder) SetComment(comment string) *Builder {
+	b.comment = comment
+	return b
+}
+
+// add a file to the nzb and return its builder to add the segments
+// a zero date is written as date 0
+func (b *Builder) AddFile(poster string, date time.Time, subject string, groups []string) *FileBuilder {
+	fb := &FileBuilder{
+		file: NzbFile{
+			Poster:  poster,
+			Subject: subject,
+			Groups:  append([]string(nil), groups...),
+		},
+	}
+
+	if !date.IsZero() {
+		fb.file.Date = int(date.Unix())
+	}
+
+	b.files = append(b.files, fb)
+
+	return fb
+}
+
+// add a segment to the file
+func (fb *FileBuilder) AddSegment(number int, bytes int64, id string) *FileBuilder {
+	fb.file.Segments = append(fb.file.Segments, NzbSegment{Number: number, Bytes: bytes, ID: id})
+	return fb
+}
+
+// build the nzb with the files in the order they were added and scanned like ScanNzbFile
+// the message-ids are taken as they were added, they are neither unescaped nor normalized
+// every call returns an independent nzb
+func (b *Builder) Build() *Nzb {
+	nzb := &Nzb{
+		Comment:   b.comment,
+		Meta:      make(map[string]string, len(b.meta)),
+		MetaMulti: make(map[string][]string, len(b.meta)),
+		Files:     make(NzbFiles, 0, len(b.files)),
+	}
+
+	for key, value := range b.meta {
+		nzb.Meta[key] = value
+		nzb.MetaMulti[key] = []string{value}
+	}
+
+	for _, fb := range b.files {
+		file := fb.file
+		file.Groups = append([]string(nil), fb.file.Groups...)
+		file.Segments = append(NzbSegments(nil), fb.file.Segments...)
+		nzb.Files = append(nzb.Files, file)
+	}
+
+	scanNzb(nzb)
+
+	return nzb
+}
+
+// append a copy of the file to the nzb and update the totals without rescanning the other files
+// the file is scanned and its message-ids are normalized like with ScanNzbFile, call Finalize after the last file
+func (n *Nzb) AppendFile(f NzbFile) {
+	file := f.clone()
+	cleanSegmentIDs(&file, true)
+	totalFiles := scanFile(&file, ParseOptions{})
+
+	n.Files = append(n.Files, file)
+
+	n.Segments = n.Segments + file.Segments.Len()
+	n.TotalSegments = n.TotalSegments + file.TotalSegments
+	n.Bytes = n.Bytes + file.Bytes
+	n.TotalBytes = n.TotalBytes + estimatedTotalBytes(&file)
+	n.TotalFiles = max(n.TotalFiles, totalFiles, n.Files.Len())
+
+	n.cache().invalidateIndex()
+}
+
+// remove the duplicates, rescan and sort the nzb once all files were added with AppendFile
+// the files are processed like by Parse with its default options
+func (n *Nzb) Finalize() {
+	makeUnique(n, ParseOptions{})
+	scanNzb(n)
+	n.Password = findPassword(n)
+	sortNzb(n, SortByNumber)
+
+	n.cache().invalidateIndex()
+}
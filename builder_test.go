@@ -0,0 +1,119 @@
+package nzbparser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuilder(t *testing.T) {
+	date := time.Date(2009, 2, 13, 23, 31, 30, 0, time.UTC)
+	groups := []string{"alt.test"}
+
+	builder := NewBuilder().
+		SetMeta("title", "Release").
+		SetComment("built")
+
+	builder.AddFile("poster@example.com", date, `[1/2] Release - "release.rar" yEnc (1/2)`, groups).
+		AddSegment(1, 100, "a-1@example").
+		AddSegment(2, 200, "a-2@example")
+	builder.AddFile("poster@example.com", time.Time{}, `[2/2] Release - "release.par2" yEnc (1/1)`, groups).
+		AddSegment(1, 50, "b&amp;1@example")
+
+	nzb := builder.Build()
+
+	if id := nzb.Files[1].Segments[0].ID; id != "b&amp;1@example" {
+		t.Errorf("Expected the message-id as added, got %q", id)
+	}
+
+	if nzb.Comment != "built" || nzb.Meta["title"] != "Release" {
+		t.Errorf("Unexpected comment %q or meta %v", nzb.Comment, nzb.Meta)
+	}
+
+	if len(nzb.Files) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(nzb.Files))
+	}
+
+	file := nzb.Files[0]
+	if file.Date != 1234567890 || file.Poster != "poster@example.com" || file.Filename != "release.rar" || file.Number != 1 {
+		t.Errorf("Unexpected file %+v", file)
+	}
+
+	if nzb.Files[1].Date != 0 {
+		t.Errorf("Expected date 0 for a zero time, got %d", nzb.Files[1].Date)
+	}
+
+	if nzb.TotalFiles != 2 || nzb.Segments != 3 || nzb.TotalSegments != 3 || nzb.Bytes != 350 {
+		t.Errorf("Unexpected totals: %d files, %d segments, %d total segments, %d bytes", nzb.TotalFiles, nzb.Segments, nzb.TotalSegments, nzb.Bytes)
+	}
+
+	// built nzbs are independent of the builder and its inputs
+	groups[0] = "alt.changed"
+	nzb.Files[0].Segments[0].ID = "changed"
+
+	again := builder.Build()
+	if again.Files[0].Groups[0] != "alt.test" || again.Files[0].Segments[0].ID != "a-1@example" {
+		t.Errorf("Expected an independent nzb, got %+v", again.Files[0])
+	}
+
+	// the built nzb can be written and parsed again
+	output, err := Write(again)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	parsed, err := ParseString(string(output))
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if parsed.Bytes != again.Bytes || parsed.Segments != again.Segments {
+		t.Errorf("Parsed totals differ: %d/%d vs %d/%d", parsed.Bytes, parsed.Segments, again.Bytes, again.Segments)
+	}
+}
+
+func TestAppendFile(t *testing.T) {
+	nzb := &Nzb{}
+
+	file := NzbFile{
+		Subject:  `[2/3] Release - "release.r00" yEnc (1/2)`,
+		Groups:   []string{"alt.test"},
+		Segments: NzbSegments{{Number: 2, Bytes: 200, ID: "<b-2@example>"}, {Number: 1, Bytes: 100, ID: "b-1@example"}},
+	}
+
+	nzb.AppendFile(file)
+
+	if nzb.Files[0].Filename != "release.r00" || nzb.Files[0].Segments[0].ID != "b-2@example" {
+		t.Errorf("Expected the appended file to be scanned, got %+v", nzb.Files[0])
+	}
+
+	// the caller's file is not changed
+	if file.Segments[0].ID != "<b-2@example>" {
+		t.Errorf("Expected the appended file to be copied, got %q", file.Segments[0].ID)
+	}
+
+	nzb.AppendFile(NzbFile{
+		Subject:  `[1/3] Release - "release.rar" yEnc (1/1)`,
+		Groups:   []string{"alt.test"},
+		Segments: NzbSegments{{Number: 1, Bytes: 50, ID: "a-1@example"}},
+	})
+	nzb.AppendFile(file)
+
+	if nzb.TotalFiles != 3 || nzb.Segments != 5 || nzb.TotalSegments != 5 || nzb.Bytes != 650 {
+		t.Errorf("Unexpected incremental totals: %d files, %d segments, %d total segments, %d bytes", nzb.TotalFiles, nzb.Segments, nzb.TotalSegments, nzb.Bytes)
+	}
+
+	if _, _, ok := nzb.SegmentByID("a-1@example"); !ok {
+		t.Error("Expected the appended segment to be found")
+	}
+
+	nzb.Finalize()
+
+	// the duplicate file is removed and the files and segments are sorted
+	if len(nzb.Files) != 2 || nzb.Files[0].Filename != "release.rar" || nzb.Files[1].Segments[0].Number != 1 {
+		t.Errorf("Unexpected finalized files %+v", nzb.Files)
+	}
+
+	if nzb.TotalFiles != 3 || nzb.Segments != 3 || nzb.Bytes != 350 {
+		t.Errorf("Unexpected finalized totals: %d files, %d segments, %d bytes", nzb.TotalFiles, nzb.Segments, nzb.Bytes)
+	}
+}
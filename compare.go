@@ -0,0 +1,152 @@
+package nzbparser
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// returns true if both nzbs are semantically identical regardless of the order of their files and segments
+// compares the comment, the meta data and the files keyed by subject (like MakeUnique) with their sets of segment message-ids
+// the order of multiple meta values of a type is ignored, nil and empty meta maps are equal
+func (n *Nzb) Equal(other *Nzb) bool {
+	if n == nil || other == nil {
+		return n == other
+	}
+
+	if n.Comment != other.Comment || !maps.Equal(n.Meta, other.Meta) {
+		return false
+	}
+
+	if !maps.EqualFunc(n.MetaMulti, other.MetaMulti, func(a, b []string) bool {
+		return slices.Equal(slices.Sorted(slices.Values(a)), slices.Sorted(slices.Values(b)))
+	}) {
+		return false
+	}
+
+	return maps.EqualFunc(segmentIDSets(n), segmentIDSets(other), func(a, b map[string]struct{}) bool {
+		return maps.Equal(a, b)
+	})
+}
+
+// returns the subjects of the files only present in n (onlyLeft) and only present in other (onlyRight), both sorted
+// files are keyed by subject like MakeUnique, their segments are not compared
+func (n *Nzb) Diff(other *Nzb) (onlyLeft, onlyRight []string) {
+	left, right := subjectSet(n), subjectSet(other)
+
+	for subject := range left {
+		if _, ok := right[subject]; !ok {
+			onlyLeft = append(onlyLeft, subject)
+		}
+	}
+
+	for subject := range right {
+		if _, ok := left[subject]; !ok {
+			onlyRight = append(onlyRight, subject)
+		}
+	}
+
+	sort.Strings(onlyLeft)
+	sort.Strings(onlyRight)
+
+	return onlyLeft, onlyRight
+}
+
+// returns the subjects of all files of the nzb
+func subjectSet(n *Nzb) map[string]struct{} {
+	subjects := make(map[string]struct{})
+
+	if n == nil {
+		return subjects
+	}
+
+	for _, file := range n.Files {
+		subjects[file.Subject] = struct{}{}
+	}
+
+	return subjects
+}
+
+// returns the set of segment message-ids of each subject, files with the same subject are united
+func segmentIDSets(n *Nzb) map[string]map[string]struct{} {
+	sets := make(map[string]map[string]struct{})
+
+	for _, file := range n.Files {
+		ids, ok := sets[file.Subject]
+		if !ok {
+			ids = make(map[string]struct{}, len(file.Segments))
+			sets[file.Subject] = ids
+		}
+
+		for _, segment := range file.Segments {
+			ids[segment.ID] = struct{}{}
+		}
+	}
+
+	return sets
+}
+
+// returns the hex encoded SHA-256 hash of a canonical form of the nzb, nzbs which are Equal have the same hash
+// the hash covers the same fields as Equal: the trimmed comment, the meta data by type with sorted values and the
+// files by subject with their sorted sets of segment message-ids, so the order of files and segments, the padding of the
+// comment, the poster formatting and the fields Equal ignores (groups, byte counts, dates) don't change it
+func (n *Nzb) CanonicalHash() string {
+	h := sha256.New()
+
+	if n == nil {
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	writeHashString(h, strings.TrimSpace(n.Comment))
+
+	// every list starts with its length, so the lists can't be confused
+	writeHashLength(h, len(n.Meta))
+
+	for _, key := range slices.Sorted(maps.Keys(n.Meta)) {
+		writeHashString(h, key)
+		writeHashString(h, n.Meta[key])
+	}
+
+	writeHashLength(h, len(n.MetaMulti))
+
+	for _, key := range slices.Sorted(maps.Keys(n.MetaMulti)) {
+		writeHashString(h, key)
+		writeHashLength(h, len(n.MetaMulti[key]))
+
+		for _, value := range slices.Sorted(slices.Values(n.MetaMulti[key])) {
+			writeHashString(h, value)
+		}
+	}
+
+	sets := segmentIDSets(n)
+	writeHashLength(h, len(sets))
+
+	for _, subject := range slices.Sorted(maps.Keys(sets)) {
+		writeHashString(h, subject)
+		writeHashLength(h, len(sets[subject]))
+
+		for _, id := range slices.Sorted(maps.Keys(sets[subject])) {
+			writeHashString(h, id)
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// write the string with its length to the hash, so the boundaries of the strings are part of the hash
+func writeHashString(h hash.Hash, s string) {
+	writeHashLength(h, len(s))
+	h.Write([]byte(s))
+}
+
+// write the length as varint to the hash
+func writeHashLength(h hash.Hash, length int) {
+	var buf [binary.MaxVarintLen64]byte
+
+	h.Write(buf[:binary.PutUvarint(buf[:], uint64(length))])
+}
@@ -0,0 +1,147 @@
+package nzbparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	nzb := func() *Nzb {
+		return &Nzb{
+			Comment:   "comment",
+			Meta:      map[string]string{"title": "Release"},
+			MetaMulti: map[string][]string{"title": {"Release"}, "tag": {"a", "b"}},
+			Files: []NzbFile{
+				{Subject: "a", Segments: []NzbSegment{{Number: 1, ID: "a-1"}, {Number: 2, ID: "a-2"}}},
+				{Subject: "b", Segments: []NzbSegment{{Number: 1, ID: "b-1"}}},
+			},
+		}
+	}
+
+	left := nzb()
+
+	// file, segment and meta value order is ignored
+	right := nzb()
+	right.Files[0], right.Files[1] = right.Files[1], right.Files[0]
+	right.Files[1].Segments[0], right.Files[1].Segments[1] = right.Files[1].Segments[1], right.Files[1].Segments[0]
+	right.MetaMulti["tag"] = []string{"b", "a"}
+
+	if !left.Equal(right) || !right.Equal(left) {
+		t.Error("Expected nzbs differing only in order to be equal")
+	}
+
+	changes := map[string]func(*Nzb){
+		"comment": func(n *Nzb) { n.Comment = "other" },
+		"meta":    func(n *Nzb) { n.Meta["title"] = "Other" },
+		"multi":   func(n *Nzb) { n.MetaMulti["tag"] = []string{"a"} },
+		"segment": func(n *Nzb) { n.Files[0].Segments[1].ID = "a-3" },
+		"subject": func(n *Nzb) { n.Files[1].Subject = "c" },
+		"files":   func(n *Nzb) { n.Files = n.Files[:1] },
+	}
+
+	for name, change := range changes {
+		other := nzb()
+		change(other)
+
+		if left.Equal(other) {
+			t.Errorf("%s: expected nzbs to differ", name)
+		}
+	}
+
+	if left.Equal(nil) || !(*Nzb)(nil).Equal(nil) {
+		t.Error("Unexpected result comparing with nil")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	left := &Nzb{Files: []NzbFile{{Subject: "a"}, {Subject: "b"}, {Subject: "c"}}}
+	right := &Nzb{Files: []NzbFile{{Subject: "d"}, {Subject: "b"}}}
+
+	onlyLeft, onlyRight := left.Diff(right)
+
+	if !reflect.DeepEqual(onlyLeft, []string{"a", "c"}) {
+		t.Errorf("Expected only left [a c], got %v", onlyLeft)
+	}
+
+	if !reflect.DeepEqual(onlyRight, []string{"d"}) {
+		t.Errorf("Expected only right [d], got %v", onlyRight)
+	}
+
+	onlyLeft, onlyRight = left.Diff(left)
+	if len(onlyLeft) != 0 || len(onlyRight) != 0 {
+		t.Errorf("Expected no differences, got %v and %v", onlyLeft, onlyRight)
+	}
+}
+
+func TestCanonicalHash(t *testing.T) {
+	nzb := func() *Nzb {
+		return &Nzb{
+			Comment:   "comment",
+			Meta:      map[string]string{"title": "Release"},
+			MetaMulti: map[string][]string{"title": {"Release"}, "tag": {"a", "b"}},
+			Files: []NzbFile{
+				{Subject: "a", Poster: "a@example.com", Segments: []NzbSegment{{Number: 1, ID: "a-1"}, {Number: 2, ID: "a-2"}}},
+				{Subject: "b", Poster: "b@example.com", Segments: []NzbSegment{{Number: 1, ID: "b-1"}}},
+			},
+		}
+	}
+
+	hash := nzb().CanonicalHash()
+	if len(hash) != 64 {
+		t.Fatalf("Expected a hex encoded SHA-256 hash, got %q", hash)
+	}
+
+	// equal nzbs, the comment padding and the poster formatting have the same hash
+	same := map[string]func(*Nzb){
+		"order": func(n *Nzb) {
+			n.Files[0], n.Files[1] = n.Files[1], n.Files[0]
+			n.Files[1].Segments[0], n.Files[1].Segments[1] = n.Files[1].Segments[1], n.Files[1].Segments[0]
+			n.MetaMulti["tag"] = []string{"b", "a"}
+		},
+		"padding": func(n *Nzb) { n.Comment = " comment " },
+		"poster":  func(n *Nzb) { n.Files[0].Poster = "A <a@example.com>" },
+	}
+
+	for name, change := range same {
+		other := nzb()
+		change(other)
+
+		if other.CanonicalHash() != hash {
+			t.Errorf("%s: expected the same hash", name)
+		}
+	}
+
+	changes := map[string]func(*Nzb){
+		"comment": func(n *Nzb) { n.Comment = "other" },
+		"meta":    func(n *Nzb) { n.Meta["title"] = "Other" },
+		"multi":   func(n *Nzb) { n.MetaMulti["tag"] = []string{"a"} },
+		"segment": func(n *Nzb) { n.Files[0].Segments[1].ID = "a-3" },
+		"subject": func(n *Nzb) { n.Files[1].Subject = "c" },
+		"files":   func(n *Nzb) { n.Files = n.Files[:1] },
+		"moved":   func(n *Nzb) { n.MetaMulti = map[string][]string{"title": {"Release", "tag", "a", "b"}} },
+	}
+
+	for name, change := range changes {
+		other := nzb()
+		change(other)
+
+		if other.CanonicalHash() == hash {
+			t.Errorf("%s: expected the hashes to differ", name)
+		}
+	}
+
+	// parsed nzbs which are equal have the same hash
+	left, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	right, err := ParseStringWithOptions(streamTestNZB, ParseOptions{NoSort: true})
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	if !left.Equal(right) || left.CanonicalHash() != right.CanonicalHash() {
+		t.Error("Expected equal parsed nzbs to have the same hash")
+	}
+}
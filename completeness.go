@@ -0,0 +1,119 @@
+package nzbparser
+
+// returns the lowest and highest segment number of the file or 0, 0 if it has no segments
+// the segment numbers may contain gaps, so max is not necessarily the segment total
+func (f *NzbFile) SegmentNumberRange() (min, max int) {
+	for i, segment := range f.Segments {
+		if i == 0 || segment.Number < min {
+			min = segment.Number
+		}
+
+		if i == 0 || segment.Number > max {
+			max = segment.Number
+		}
+	}
+
+	return min, max
+}
+
+// returns the sorted segment numbers between 1 and TotalSegments that are not present in the file
+// relies on TotalSegments as computed by ScanNzbFile, which is the subject total with ParseOptions.TrustSubjectSegmentTotal
+// at most MaxSubjectTotal numbers beyond the present segments are reported, so a huge total doesn't exhaust the memory
+func (f *NzbFile) MissingSegments() []int {
+	if f.TotalSegments <= 0 {
+		return nil
+	}
+
+	last := min(f.TotalSegments, len(f.Segments)+MaxSubjectTotal)
+
+	present := make(map[int]struct{}, len(f.Segments))
+	for _, segment := range f.Segments {
+		present[segment.Number] = struct{}{}
+	}
+
+	var missing []int
+
+	for number := 1; number <= last; number++ {
+		if _, ok := present[number]; !ok {
+			missing = append(missing, number)
+		}
+	}
+
+	return missing
+}
+
+// returns the ratio of available segments to the total segments of all files (0..1)
+// files without any total segments count as complete
+func (n *Nzb) Completeness() float64 {
+	var available, total int
+
+	for _, file := range n.Files {
+		if file.TotalSegments <= 0 {
+			continue
+		}
+
+		// more segments than the total (e.g. duplicates) never count as more than complete
+		available = available + min(file.Segments.Len(), file.TotalSegments)
+		total = total + file.TotalSegments
+	}
+
+	if total == 0 {
+		return 1
+	}
+
+	return float64(available) / float64(total)
+}
+
+// returns the missing segment numbers (see MissingSegments) of all incomplete files keyed by the file subject
+// complete files have no entry, so a lookup returns an empty slice for them
+// relies on TotalSegments as computed by ScanNzbFile, the numbers of each file are capped like with MissingSegments
+func (n *Nzb) MissingSegmentsReport() map[string][]int {
+	report := make(map[string][]int)
+
+	for id := range n.Files {
+		if missing := n.Files[id].MissingSegments(); len(missing) > 0 {
+			report[n.Files[id].Subject] = missing
+		}
+	}
+
+	return report
+}
+
+// returns the ratio of available segments to the total segments of the file (0..1)
+// a file without total segments counts as complete, relies on TotalSegments as computed by ScanNzbFile
+func (f *NzbFile) SegmentCompleteness() float64 {
+	if f.TotalSegments <= 0 {
+		return 1
+	}
+
+	return float64(min(f.Segments.Len(), f.TotalSegments)) / float64(f.TotalSegments)
+}
+
+// returns the ratio of available files to the total files of the nzb (0..1)
+// an nzb without total files counts as complete, relies on TotalFiles as computed by ScanNzbFile
+func (n *Nzb) FileCompleteness() float64 {
+	if n.TotalFiles <= 0 {
+		return 1
+	}
+
+	return float64(min(n.Files.Len(), n.TotalFiles)) / float64(n.TotalFiles)
+}
+
+// returns true if the nzb seems fully downloadable: all files of the total are present and no file misses any segment
+// number up to its total (see MissingSegments), so duplicate segments don't make up for missing ones
+// an nzb without files is not complete
+// subjects without totals count as 1/1, so the observed segments and files are complete on their own
+// relies on TotalFiles and TotalSegments as computed by ScanNzbFile
+func (n *Nzb) IsComplete() bool {
+	if n.Files.Len() == 0 || n.TotalFiles > n.Files.Len() {
+		return false
+	}
+
+	for id := range n.Files {
+		if len(n.Files[id].MissingSegments()) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,304 @@
+package nzbparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissingSegments(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{
+				Subject: "[1/3] Test - \"a.rar\" yEnc (1/5)",
+				Segments: []NzbSegment{
+					{Number: 4, Bytes: 100, ID: "a-4"},
+					{Number: 1, Bytes: 100, ID: "a-1"},
+				},
+			},
+			{
+				Subject: "[2/3] Test - \"b.rar\" yEnc (1/2)",
+				Segments: []NzbSegment{
+					{Number: 1, Bytes: 100, ID: "b-1"},
+					{Number: 2, Bytes: 100, ID: "b-2"},
+				},
+			},
+			{
+				// subject reports fewer segments than actually present
+				Subject: "[3/3] Test - \"c.rar\" yEnc (1/1)",
+				Segments: []NzbSegment{
+					{Number: 1, Bytes: 100, ID: "c-1"},
+					{Number: 2, Bytes: 100, ID: "c-2"},
+					{Number: 3, Bytes: 100, ID: "c-3"},
+				},
+			},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	if missing := nzb.Files[0].MissingSegments(); !reflect.DeepEqual(missing, []int{2, 3, 5}) {
+		t.Errorf("Expected missing segments [2 3 5], got %v", missing)
+	}
+
+	if missing := nzb.Files[1].MissingSegments(); len(missing) != 0 {
+		t.Errorf("Expected no missing segments, got %v", missing)
+	}
+
+	if missing := nzb.Files[2].MissingSegments(); len(missing) != 0 {
+		t.Errorf("Expected no missing segments when more segments than reported are present, got %v", missing)
+	}
+
+	empty := NzbFile{}
+	if missing := empty.MissingSegments(); missing != nil {
+		t.Errorf("Expected nil for a file with zero total segments, got %v", missing)
+	}
+
+	// a huge total set by hand is capped beyond the present segments
+	limit := MaxSubjectTotal
+	defer func() { MaxSubjectTotal = limit }()
+
+	MaxSubjectTotal = 10
+
+	huge := NzbFile{TotalSegments: 999999999, Segments: []NzbSegment{{Number: 1, ID: "h-1"}}}
+	if missing := huge.MissingSegments(); !reflect.DeepEqual(missing, []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 11}) {
+		t.Errorf("Expected the missing segments to be capped, got %v", missing)
+	}
+}
+
+func TestCompleteness(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{
+				Subject: "[1/2] Test - \"a.rar\" yEnc (1/4)",
+				Segments: []NzbSegment{
+					{Number: 1, Bytes: 100, ID: "a-1"},
+					{Number: 2, Bytes: 100, ID: "a-2"},
+					{Number: 3, Bytes: 100, ID: "a-3"},
+				},
+			},
+			{
+				Subject: "[2/2] Test - \"b.rar\" yEnc (1/4)",
+				Segments: []NzbSegment{
+					{Number: 1, Bytes: 100, ID: "b-1"},
+					{Number: 2, Bytes: 100, ID: "b-2"},
+					{Number: 3, Bytes: 100, ID: "b-3"},
+					{Number: 4, Bytes: 100, ID: "b-4"},
+				},
+			},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	if completeness := nzb.Completeness(); completeness != 7.0/8.0 {
+		t.Errorf("Expected completeness 0.875, got %f", completeness)
+	}
+
+	// files with zero total segments are complete
+	if completeness := (&Nzb{Files: []NzbFile{{}}}).Completeness(); completeness != 1 {
+		t.Errorf("Expected completeness 1 for zero total segments, got %f", completeness)
+	}
+
+	// duplicate segments never exceed 100%
+	duplicates := &Nzb{
+		Files: []NzbFile{
+			{
+				TotalSegments: 1,
+				Segments: []NzbSegment{
+					{Number: 1, Bytes: 100, ID: "a-1"},
+					{Number: 1, Bytes: 100, ID: "a-1"},
+				},
+			},
+		},
+	}
+
+	if completeness := duplicates.Completeness(); completeness != 1 {
+		t.Errorf("Expected completeness 1 for duplicate segments, got %f", completeness)
+	}
+}
+
+func TestMissingSegmentsReport(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{
+				Subject: "[1/2] Test - \"a.rar\" yEnc (1/5)",
+				Segments: []NzbSegment{
+					{Number: 4, Bytes: 100, ID: "a-4"},
+					{Number: 1, Bytes: 100, ID: "a-1"},
+				},
+			},
+			{
+				Subject: "[2/2] Test - \"b.rar\" yEnc (1/2)",
+				Segments: []NzbSegment{
+					{Number: 1, Bytes: 100, ID: "b-1"},
+					{Number: 2, Bytes: 100, ID: "b-2"},
+				},
+			},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	report := nzb.MissingSegmentsReport()
+
+	expected := map[string][]int{
+		"[1/2] Test - \"a.rar\" yEnc (1/5)": {2, 3, 5},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("Expected report %v, got %v", expected, report)
+	}
+
+	if missing := report["[2/2] Test - \"b.rar\" yEnc (1/2)"]; len(missing) != 0 {
+		t.Errorf("Expected no missing segments for a complete file, got %v", missing)
+	}
+
+	// huge segment numbers and totals don't blow up the report
+	nzb.Files[1].Segments = append(nzb.Files[1].Segments, NzbSegment{Number: 999999999, ID: "b-huge"})
+	nzb.Files[0].TotalSegments = 999999999
+
+	ScanNzbFile(nzb)
+
+	report = nzb.MissingSegmentsReport()
+	if missing := report["[2/2] Test - \"b.rar\" yEnc (1/2)"]; len(missing) != MaxSubjectTotal+1 {
+		t.Errorf("Expected %d missing segments for a huge segment number, got %d", MaxSubjectTotal+1, len(missing))
+	}
+
+	if missing := report["[1/2] Test - \"a.rar\" yEnc (1/5)"]; len(missing) != 3 {
+		t.Errorf("Expected the rescanned total of the subject, got %d missing segments", len(missing))
+	}
+
+	nzb.Files[0].TotalSegments = 999999999
+
+	report = nzb.MissingSegmentsReport()
+	if missing := report["[1/2] Test - \"a.rar\" yEnc (1/5)"]; len(missing) != MaxSubjectTotal {
+		t.Errorf("Expected %d missing segments for a huge total, got %d", MaxSubjectTotal, len(missing))
+	}
+}
+
+func TestSegmentCompleteness(t *testing.T) {
+	cases := []struct {
+		file     NzbFile
+		expected float64
+	}{
+		{NzbFile{TotalSegments: 4, Segments: []NzbSegment{{Number: 1}, {Number: 2}, {Number: 3}}}, 0.75},
+		{NzbFile{TotalSegments: 2, Segments: []NzbSegment{{Number: 1}, {Number: 2}, {Number: 3}}}, 1},
+		{NzbFile{TotalSegments: 0}, 1},
+		{NzbFile{TotalSegments: 2}, 0},
+	}
+
+	for i, c := range cases {
+		if got := c.file.SegmentCompleteness(); got != c.expected {
+			t.Errorf("Case %d: expected %v, got %v", i, c.expected, got)
+		}
+	}
+}
+
+func TestFileCompleteness(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: "[1/5] Test - \"a.rar\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, ID: "a-1"}}},
+			{Subject: "[2/5] Test - \"b.rar\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, ID: "b-1"}}},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	if got := nzb.FileCompleteness(); got != 0.4 {
+		t.Errorf("Expected file completeness 0.4, got %v", got)
+	}
+
+	if got := (&Nzb{}).FileCompleteness(); got != 1 {
+		t.Errorf("Expected an empty nzb to be complete, got %v", got)
+	}
+
+	// more files than stated are clamped
+	nzb.TotalFiles = 1
+	if got := nzb.FileCompleteness(); got != 1 {
+		t.Errorf("Expected file completeness to be clamped to 1, got %v", got)
+	}
+}
+
+func TestSegmentNumberRange(t *testing.T) {
+	file := NzbFile{Segments: NzbSegments{{Number: 4}, {Number: 2}, {Number: 9}}}
+	if min, max := file.SegmentNumberRange(); min != 2 || max != 9 {
+		t.Errorf("Expected range 2-9, got %d-%d", min, max)
+	}
+
+	if min, max := (&NzbFile{}).SegmentNumberRange(); min != 0 || max != 0 {
+		t.Errorf("Expected range 0-0 without segments, got %d-%d", min, max)
+	}
+}
+
+func TestTrustSubjectSegmentTotal(t *testing.T) {
+	// the poster skipped the numbers of suppressed articles
+	gapNZB := `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="poster" date="1" subject="&quot;a.rar&quot; yEnc (1/3)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="1">a-1@test</segment>
+      <segment bytes="100" number="3">a-3@test</segment>
+      <segment bytes="100" number="5">a-5@test</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	// the highest segment number is taken by default
+	nzb, err := ParseString(gapNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if file := nzb.Files[0]; file.TotalSegments != 5 || file.SegmentCompleteness() != 0.6 {
+		t.Errorf("Expected 5 total segments, got %d (%v complete)", file.TotalSegments, file.SegmentCompleteness())
+	}
+
+	nzb, err = ParseStringWithOptions(gapNZB, ParseOptions{TrustSubjectSegmentTotal: true})
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	if file := nzb.Files[0]; file.TotalSegments != 3 || file.SegmentCompleteness() != 1 || nzb.Completeness() != 1 {
+		t.Errorf("Expected the subject total of 3 segments, got %d (%v complete)", file.TotalSegments, file.SegmentCompleteness())
+	}
+}
+
+func TestIsComplete(t *testing.T) {
+	cases := []struct {
+		name     string
+		files    []NzbFile
+		complete bool
+	}{
+		{"complete", []NzbFile{
+			{Subject: "[1/2] Test - \"a.rar\" yEnc (1/2)", Segments: []NzbSegment{{Number: 1, ID: "a-1"}, {Number: 2, ID: "a-2"}}},
+			{Subject: "[2/2] Test - \"b.rar\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, ID: "b-1"}}},
+		}, true},
+		{"missing segment", []NzbFile{
+			{Subject: "[1/2] Test - \"a.rar\" yEnc (1/3)", Segments: []NzbSegment{{Number: 1, ID: "a-1"}, {Number: 2, ID: "a-2"}}},
+			{Subject: "[2/2] Test - \"b.rar\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, ID: "b-1"}}},
+		}, false},
+		{"missing file", []NzbFile{
+			{Subject: "[1/3] Test - \"a.rar\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, ID: "a-1"}}},
+			{Subject: "[2/3] Test - \"b.rar\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, ID: "b-1"}}},
+		}, false},
+		{"duplicate segment instead of a missing one", []NzbFile{
+			{Subject: "\"a.rar\" yEnc (1/2)", Segments: []NzbSegment{{Number: 1, ID: "a-1"}, {Number: 1, ID: "a-1-repost"}}},
+		}, false},
+		{"gap in the segment numbers", []NzbFile{
+			{Subject: "\"a.rar\" yEnc", Segments: []NzbSegment{{Number: 1, ID: "a-1"}, {Number: 3, ID: "a-3"}}},
+		}, false},
+		{"no totals", []NzbFile{
+			{Subject: "a.rar", Segments: []NzbSegment{{Number: 1, ID: "a-1"}, {Number: 2, ID: "a-2"}}},
+			{Subject: "b.rar", Segments: []NzbSegment{{Number: 1, ID: "b-1"}}},
+		}, true},
+		{"no files", nil, false},
+	}
+
+	for _, c := range cases {
+		nzb := &Nzb{Files: c.files}
+		ScanNzbFile(nzb)
+
+		if got := nzb.IsComplete(); got != c.complete {
+			t.Errorf("%s: expected complete %v, got %v", c.name, c.complete, got)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package nzbparser
+
+import (
+	"errors"
+)
+
+var (
+	// the data could not be decoded as nzb file
+	ErrInvalidNZB = errors.New("unable to parse NZB file")
+	// the nzb file was decoded but does not contain any files
+	ErrEmptyNZB = errors.New("NZB file contains no files")
+	// the nzb file exceeds one of the limits of the parse options (MaxBytes, MaxFiles, MaxSegmentsPerFile)
+	ErrTooLarge = errors.New("NZB file too large")
+	// the files of the nzb file don't have any bytes (with ParseOptions.RejectZeroBytes)
+	ErrNoPayload = errors.New("NZB file contains no payload")
+	// the nzb file was rejected by ParseOptions.Validator
+	ErrRejected = errors.New("NZB file rejected")
+	// the stream writer was already closed
+	ErrWriterClosed = errors.New("NZB stream writer closed")
+)
@@ -0,0 +1,60 @@
+package nzbparser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	// not xml at all
+	_, err := ParseString("This is not a valid NZB file")
+	if !errors.Is(err, ErrInvalidNZB) {
+		t.Errorf("Expected ErrInvalidNZB for non-xml input, got %v", err)
+	}
+
+	// valid xml but not an nzb
+	_, err = ParseString(`<?xml version="1.0"?><rss><channel/></rss>`)
+	if !errors.Is(err, ErrInvalidNZB) {
+		t.Errorf("Expected ErrInvalidNZB for a wrong root element, got %v", err)
+	}
+
+	// truncated nzb
+	_, err = ParseString(Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb"><file subject="test">`)
+	if !errors.Is(err, ErrInvalidNZB) {
+		t.Errorf("Expected ErrInvalidNZB for a truncated nzb, got %v", err)
+	}
+
+	if err != nil && !strings.HasPrefix(err.Error(), "unable to parse NZB file: ") {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+
+	// nzb without files
+	_, err = ParseString(Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb"><head><meta type="title">Empty</meta></head></nzb>`)
+	if !errors.Is(err, ErrEmptyNZB) {
+		t.Errorf("Expected ErrEmptyNZB, got %v", err)
+	}
+
+	// nzb without bytes, only rejected on request
+	zeroBytes := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb"><file subject="test"><groups><group>alt.test</group></groups><segments><segment bytes="0" number="1">a@b</segment></segments></file></nzb>`
+
+	nzb, err := ParseString(zeroBytes)
+	if err != nil || nzb.HasPayload() {
+		t.Errorf("Expected an nzb without payload, got %v", err)
+	}
+
+	_, err = ParseStringWithOptions(zeroBytes, ParseOptions{RejectZeroBytes: true})
+	if !errors.Is(err, ErrNoPayload) {
+		t.Errorf("Expected ErrNoPayload, got %v", err)
+	}
+
+	if nzb, err := ParseStringWithOptions(streamTestNZB, ParseOptions{RejectZeroBytes: true}); err != nil || !nzb.HasPayload() {
+		t.Errorf("Expected an nzb with payload, got %v", err)
+	}
+
+	// i/o errors are passed through unwrapped
+	_, err = Parse(ErrorReader{})
+	if err == nil || errors.Is(err, ErrInvalidNZB) || err.Error() != "mock read error" {
+		t.Errorf("Expected unwrapped reader error, got %v", err)
+	}
+}
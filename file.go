@@ -0,0 +1,439 @@
+package nzbparser
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// file categories as returned by NzbFile.Category
+const (
+	CategoryVideo    = "video"
+	CategoryArchive  = "archive"
+	CategoryPar2     = "par2"
+	CategorySubtitle = "subtitle"
+	CategoryNfo      = "nfo"
+	CategoryImage    = "image"
+	CategoryOther    = "other"
+	CategoryUnknown  = "unknown"
+)
+
+var (
+	// par2 files including recovery volumes (name.vol03+04.par2)
+	par2RE = regexp.MustCompile(`(?i)\.(?:vol\d+\+\d+\.)?par2?$`)
+	// archives including multipart rar (name.r00, name.part01.rar) and split 7z volumes (name.7z.001)
+	archiveRE  = regexp.MustCompile(`(?i)\.(?:part\d+\.rar|rar|r\d{2,3}|7z(?:\.\d{3})?|zip|tar|gz|bz2|xz)$`)
+	videoRE    = regexp.MustCompile(`(?i)\.(?:mkv|avi|mp4|m4v|mov|wmv|flv|webm|mpg|mpeg|ts|m2ts|vob)$`)
+	subtitleRE = regexp.MustCompile(`(?i)\.(?:srt|sub|idx|ass|ssa|vtt)$`)
+	nfoRE      = regexp.MustCompile(`(?i)\.nfo$`)
+	imageRE    = regexp.MustCompile(`(?i)\.(?:jpg|jpeg|png|gif|bmp|webp)$`)
+	// archive volumes in the new (name.part01.rar), old (name.rar, name.r00) and 7z (name.7z.001) naming schemes
+	volumeRE = regexp.MustCompile(`(?i)\.(?:part(\d+)\.rar|r(\d{2,3})|7z\.(\d{3})|rar|7z)$`)
+	// volume suffixes left in a basefilename (name.part01, name.r00, name.7z, name.vol03+04)
+	volumeSuffixRE = regexp.MustCompile(`(?i)\.(?:part\d+|r\d{2,3}|7z|vol\d+\+\d+)$`)
+)
+
+// returns the category of the file (one of the Category constants) based on its filename
+// relies on the filename populated by ScanNzbFile, files without a filename are "unknown"
+func (f *NzbFile) Category() string {
+	if f.Filename == "" {
+		return CategoryUnknown
+	}
+
+	switch {
+	case f.IsPar2():
+		return CategoryPar2
+	case f.IsArchive():
+		return CategoryArchive
+	case videoRE.MatchString(f.Filename):
+		return CategoryVideo
+	case subtitleRE.MatchString(f.Filename):
+		return CategorySubtitle
+	case f.IsNfo():
+		return CategoryNfo
+	case imageRE.MatchString(f.Filename):
+		return CategoryImage
+	default:
+		return CategoryOther
+	}
+}
+
+// returns the lowercased extension of the filename without the dot or an empty string if there is none
+// compound extensions return their last part (part01.rar and vol03+04.par2 become rar and par2, 7z.001 becomes 7z)
+func (f *NzbFile) Extension() string {
+	return fileExtension(f.Filename, f.Basefilename)
+}
+
+// returns true if the file is a par2 file, including recovery volumes (name.vol03+04.par2)
+func (f *NzbFile) IsPar2() bool {
+	return par2RE.MatchString(f.Filename)
+}
+
+// returns true if the file is an archive or archive volume (name.rar, name.r00, name.part01.rar, name.zip, name.7z, name.7z.001, ...)
+func (f *NzbFile) IsArchive() bool {
+	return archiveRE.MatchString(f.Filename)
+}
+
+// returns true if the file is an nfo file
+func (f *NzbFile) IsNfo() bool {
+	return nfoRE.MatchString(f.Filename)
+}
+
+// returns the post date of the file in UTC or the zero time if the date is unknown
+func (f *NzbFile) PostedAt() time.Time {
+	if f.Date == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(int64(f.Date), 0).UTC()
+}
+
+// returns the time passed since the file was posted or 0 if the date is unknown
+func (f *NzbFile) Age() time.Duration {
+	if f.Date == 0 {
+		return 0
+	}
+
+	return time.Since(f.PostedAt())
+}
+
+// check if the file seems to have an obfuscated (hash-like or random) name
+// the heuristic is conservative: the basefilename must be at least 16 characters long without any
+// spaces, dots or other separators and either consist of hex characters only or be a random looking
+// mix of at least 20 upper case, lower case and digit characters
+func (f *NzbFile) IsObfuscated() bool {
+	name := f.Basefilename
+	if name == "" {
+		name = f.Filename
+	}
+
+	if len(name) < 16 {
+		return false
+	}
+
+	hex := true
+	transitions := 0 // changes between upper case, lower case and digit characters
+	previous := 0
+
+	for i := 0; i < len(name); i++ {
+		var class int
+
+		switch c := name[i]; {
+		case c >= '0' && c <= '9':
+			class = 1
+		case c >= 'a' && c <= 'z':
+			class = 2
+			hex = hex && c <= 'f'
+		case c >= 'A' && c <= 'Z':
+			class = 3
+			hex = hex && c <= 'F'
+		default:
+			// spaces, separators and non-ascii characters
+			return false
+		}
+
+		if previous != 0 && class != previous {
+			transitions++
+		}
+
+		previous = class
+	}
+
+	if hex {
+		return true
+	}
+
+	return len(name) >= 20 && transitions*2 >= len(name)
+}
+
+// returns the indices of the files with obfuscated names
+func (n *Nzb) ObfuscatedFiles() []int {
+	var indices []int
+
+	for id := range n.Files {
+		if n.Files[id].IsObfuscated() {
+			indices = append(indices, id)
+		}
+	}
+
+	return indices
+}
+
+// proposes filenames for the obfuscated files built from the title meta data and the extension of the file including
+// its volume (e.g. Title.part01.rar), mapped to the index of the file
+// the names are a naming heuristic only (the par2 files are not parsed), files with good filenames are left out and no
+// name is proposed twice or for a filename already in use, the map is empty without a title
+func (n *Nzb) ProposeFilenames() map[int]string {
+	names := make(map[int]string)
+
+	title, _ := metaValue(n.Meta, "title")
+	title = strings.NewReplacer("/", "_", "\\", "_").Replace(strings.TrimSpace(title))
+
+	if title == "" {
+		return names
+	}
+
+	// names already taken, filenames are compared case-insensitively
+	used := make(map[string]struct{})
+
+	for _, file := range n.Files {
+		if !file.IsObfuscated() {
+			used[strings.ToLower(file.Filename)] = struct{}{}
+		}
+	}
+
+	for _, id := range n.ObfuscatedFiles() {
+		suffix := proposedSuffix(&n.Files[id])
+		name := title + suffix
+
+		for i := 2; ; i++ {
+			if _, ok := used[strings.ToLower(name)]; !ok {
+				break
+			}
+
+			name = title + "." + strconv.Itoa(i) + suffix
+		}
+
+		used[strings.ToLower(name)] = struct{}{}
+		names[id] = name
+	}
+
+	return names
+}
+
+// returns the extension of the file including its volume with the leading dot or an empty string if there is none
+func proposedSuffix(f *NzbFile) string {
+	if suffix := volumeRE.FindString(f.Filename); suffix != "" {
+		return strings.ToLower(suffix)
+	}
+
+	if suffix := par2RE.FindString(f.Filename); suffix != "" {
+		return strings.ToLower(suffix)
+	}
+
+	if ext := f.Extension(); ext != "" {
+		return "." + ext
+	}
+
+	return ""
+}
+
+// returns a pointer to the first file whose filename matches name case-insensitively
+// the pointer refers to the file inside the nzb, so changes to it are kept
+func (n *Nzb) FileByFilename(name string) (*NzbFile, bool) {
+	for id := range n.Files {
+		if strings.EqualFold(n.Files[id].Filename, name) {
+			return &n.Files[id], true
+		}
+	}
+
+	return nil, false
+}
+
+// returns a pointer to the first file with the given file number
+// relies on Number as computed by ScanNzbFile, the pointer refers to the file inside the nzb
+func (n *Nzb) FileByNumber(num int) (*NzbFile, bool) {
+	for id := range n.Files {
+		if n.Files[id].Number == num {
+			return &n.Files[id], true
+		}
+	}
+
+	return nil, false
+}
+
+// returns the zero based position of the archive volume in extraction order, parsed from the filename
+// name.part01.rar and name.7z.001 are the first volume (0), in the old rar scheme name.rar is 0 and name.r00 is 1
+// returns false for files which are not archive volumes
+func (f *NzbFile) VolumeIndex() (int, bool) {
+	m := volumeRE.FindStringSubmatch(f.Filename)
+	if m == nil {
+		return 0, false
+	}
+
+	switch {
+	case m[1] != "":
+		// name.part01.rar
+		return volumeNumber(m[1], 1)
+	case m[2] != "":
+		// name.r00 follows name.rar
+		return volumeNumber(m[2], -1)
+	case m[3] != "":
+		// name.7z.001
+		return volumeNumber(m[3], 1)
+	default:
+		// name.rar or a single name.7z
+		return 0, true
+	}
+}
+
+// returns the one based position of the file in the file set as numbered by the poster (X in [X/Y] of the subject)
+// it is the Number computed by ScanNzbFile and unrelated to the archive volume order of VolumeIndex, 0 if unknown
+func (f *NzbFile) PartNumber() int {
+	return f.Number
+}
+
+// returns the highest part number of the files (see PartNumber) or 0 if none is known
+func (n *Nzb) MaxPartNumber() int {
+	highest := 0
+
+	for id := range n.Files {
+		highest = max(highest, n.Files[id].PartNumber())
+	}
+
+	return highest
+}
+
+// converts the volume number to an index by subtracting first, indices below zero are invalid
+func volumeNumber(number string, first int) (int, bool) {
+	n, err := strconv.Atoi(number)
+	if err != nil || n-first < 0 {
+		return 0, false
+	}
+
+	return n - first, true
+}
+
+// groups the files by their release base, the Basefilename as populated by ScanNzbFile without a volume suffix
+// name.part01, name.part02 and name.r00 are all grouped under name, files are kept in their nzb order
+func (n *Nzb) GroupByBasefilename() map[string]NzbFiles {
+	groups := make(map[string]NzbFiles)
+
+	for _, file := range n.Files {
+		base := releaseBase(&file)
+		groups[base] = append(groups[base], file)
+	}
+
+	return groups
+}
+
+// returns the basefilename of the file without a volume suffix or the full basefilename if nothing is left
+func releaseBase(f *NzbFile) string {
+	if base := volumeSuffixRE.ReplaceAllString(f.Basefilename, ""); base != "" {
+		return base
+	}
+
+	return f.Basefilename
+}
+
+// returns the indices of the files whose category conflicts with the other files of their release base
+// (see GroupByBasefilename), e.g. a single video or text file within a set of archive volumes
+// the heuristic is conservative: par2, nfo and unknown files are ignored and a file is only reported if
+// at least two other files of its release base share one category that is different from its own
+func (n *Nzb) SuspiciousFiles() []int {
+	// indices of the files of each release base by category
+	bases := make(map[string]map[string][]int)
+
+	for id := range n.Files {
+		switch category := n.Files[id].Category(); category {
+		case CategoryPar2, CategoryNfo, CategoryUnknown:
+		default:
+			base := releaseBase(&n.Files[id])
+			if bases[base] == nil {
+				bases[base] = make(map[string][]int)
+			}
+
+			bases[base][category] = append(bases[base][category], id)
+		}
+	}
+
+	var indices []int
+
+	for _, categories := range bases {
+		if len(categories) != 2 {
+			continue
+		}
+
+		for category, ids := range categories {
+			for other, siblings := range categories {
+				if other != category && len(ids) == 1 && len(siblings) >= 2 {
+					indices = append(indices, ids[0])
+				}
+			}
+		}
+	}
+
+	sort.Ints(indices)
+
+	return indices
+}
+
+// returns the name of the release for matching it against other sources
+// the name or title meta data is preferred, followed by the most common subject header of the files and
+// the longest common prefix of the basefilenames, without volume suffixes (name.part01, name.vol03+04) and
+// separators left at the end, an empty string is only returned if none of them gives a name
+func (n *Nzb) ReleaseName() string {
+	if name := n.Name(); name != "" {
+		return name
+	}
+
+	if title := n.Title(); title != "" {
+		return title
+	}
+
+	// the first header wins if several headers are equally common
+	var best string
+
+	counts := make(map[string]int)
+
+	for _, subject := range n.Subjects() {
+		header := cleanReleaseName(subject.Header)
+		if header == "" {
+			continue
+		}
+
+		counts[header]++
+
+		if counts[header] > counts[best] {
+			best = header
+		}
+	}
+
+	if best != "" {
+		return best
+	}
+
+	var prefix string
+
+	found := false
+
+	for _, file := range n.Files {
+		if file.Basefilename == "" {
+			continue
+		}
+
+		if !found {
+			prefix, found = file.Basefilename, true
+			continue
+		}
+
+		prefix = commonPrefix(prefix, file.Basefilename)
+	}
+
+	return cleanReleaseName(prefix)
+}
+
+// returns the name without a volume suffix and without spaces, dashes, dots and underscores at its ends
+func cleanReleaseName(name string) string {
+	name = strings.Trim(name, " -._")
+	name = volumeSuffixRE.ReplaceAllString(name, "")
+
+	return strings.Trim(name, " -._")
+}
+
+// returns the longest common prefix of a and b without splitting a character
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	for i > 0 && i < len(a) && !utf8.RuneStart(a[i]) {
+		i--
+	}
+
+	return a[:i]
+}
@@ -0,0 +1,425 @@
+package nzbparser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCategory(t *testing.T) {
+	cases := []struct {
+		subject  string
+		category string
+	}{
+		{`[1/9] Release - "release.mkv" yEnc (1/100)`, CategoryVideo},
+		{`[2/9] Release - "release.rar" yEnc (1/100)`, CategoryArchive},
+		{`[3/9] Release - "release.r00" yEnc (1/100)`, CategoryArchive},
+		{`[4/9] Release - "release.part01.rar" yEnc (1/100)`, CategoryArchive},
+		{`[5/9] Release - "release.7z.001" yEnc (1/100)`, CategoryArchive},
+		{`[6/9] Release - "release.par2" yEnc (1/1)`, CategoryPar2},
+		{`[7/9] Release - "release.vol03+04.par2" yEnc (1/5)`, CategoryPar2},
+		{`[8/9] Release - "release.nfo" yEnc (1/1)`, CategoryNfo},
+		{`[9/9] Release - "release.srt" yEnc (1/1)`, CategorySubtitle},
+		{`[1/2] Release - "cover.jpg" yEnc (1/1)`, CategoryImage},
+		{`[2/2] Release - "release.exe" yEnc (1/1)`, CategoryOther},
+	}
+
+	for _, c := range cases {
+		nzb := &Nzb{Files: []NzbFile{{Subject: c.subject}}}
+		ScanNzbFile(nzb)
+
+		if category := nzb.Files[0].Category(); category != c.category {
+			t.Errorf("Expected category %q for %q, got %q", c.category, c.subject, category)
+		}
+	}
+
+	// files without a filename are unknown
+	file := NzbFile{}
+	if category := file.Category(); category != CategoryUnknown {
+		t.Errorf("Expected category %q for a file without filename, got %q", CategoryUnknown, category)
+	}
+}
+
+func TestPostedAt(t *testing.T) {
+	file := NzbFile{Date: 1234567890}
+
+	if posted := file.PostedAt(); !posted.Equal(time.Date(2009, 2, 13, 23, 31, 30, 0, time.UTC)) || posted.Location() != time.UTC {
+		t.Errorf("Unexpected post date %v", posted)
+	}
+
+	if age := file.Age(); age < time.Since(time.Date(2009, 2, 13, 23, 31, 30, 0, time.UTC))-time.Minute {
+		t.Errorf("Unexpected age %v", age)
+	}
+
+	// unknown dates
+	unknown := NzbFile{}
+
+	if posted := unknown.PostedAt(); !posted.IsZero() {
+		t.Errorf("Expected zero time for unknown date, got %v", posted)
+	}
+
+	if age := unknown.Age(); age != 0 {
+		t.Errorf("Expected zero age for unknown date, got %v", age)
+	}
+}
+
+func TestIsObfuscated(t *testing.T) {
+	cases := []struct {
+		basefilename string
+		obfuscated   bool
+	}{
+		{"d41d8cd98f00b204e9800998ecf8427e", true},
+		{"D41D8CD98F00B204E9800998ECF8427E", true},
+		{"aB3dE9xQ2mN7pL0kR5sT8vW1", true},
+		{"show.s01e01.1080p", false},
+		{"Show.Name.S01E01.1080p.WEB.h264-GROUP", false},
+		{"ShowName2024Remux", false},
+		{"ThisIsAVeryLongReleaseName", false},
+		{"My Release Name 2024", false},
+		{"abc123", false},
+		{"deadbeef", false},
+		{"", false},
+	}
+
+	for _, c := range cases {
+		file := NzbFile{Basefilename: c.basefilename}
+		if obfuscated := file.IsObfuscated(); obfuscated != c.obfuscated {
+			t.Errorf("Expected IsObfuscated %v for %q, got %v", c.obfuscated, c.basefilename, obfuscated)
+		}
+	}
+}
+
+func TestObfuscatedFiles(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: `[1/3] "show.s01e01.1080p.mkv" yEnc (1/1)`},
+			{Subject: `[2/3] "d41d8cd98f00b204e9800998ecf8427e" yEnc (1/1)`},
+			{Subject: `[3/3] "aB3dE9xQ2mN7pL0kR5sT8vW1.rar" yEnc (1/1)`},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	indices := nzb.ObfuscatedFiles()
+	if len(indices) != 2 || indices[0] != 1 || indices[1] != 2 {
+		t.Errorf("Expected obfuscated files [1 2], got %v", indices)
+	}
+}
+
+func TestProposeFilenames(t *testing.T) {
+	nzb := &Nzb{
+		Meta: map[string]string{"Title": "Some Release"},
+		Files: []NzbFile{
+			{Subject: `[1/6] "aB3dE9xQ2mN7pL0kR5sT8vW1.part01.rar" yEnc (1/1)`},
+			{Subject: `[2/6] "zY8xW7vU6tS5rQ4pO3nM2lK1.part02.rar" yEnc (1/1)`},
+			{Subject: `[3/6] "d41d8cd98f00b204e9800998ecf8427e.mkv" yEnc (1/1)`},
+			{Subject: `[4/6] "e41d8cd98f00b204e9800998ecf8427e.mkv" yEnc (1/1)`},
+			{Subject: `[5/6] "f41d8cd98f00b204e9800998ecf8427e" yEnc (1/1)`},
+			{Subject: `[6/6] "Some Release.nfo" yEnc (1/1)`},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	expected := map[int]string{
+		0: "Some Release.part01.rar",
+		1: "Some Release.part02.rar",
+		2: "Some Release.mkv",
+		3: "Some Release.2.mkv",
+		4: "Some Release",
+	}
+
+	if names := nzb.ProposeFilenames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected names %v, got %v", expected, names)
+	}
+
+	// names of files which are not obfuscated are not proposed again
+	nzb.Files[5].Filename = "some release.mkv"
+
+	if names := nzb.ProposeFilenames(); names[2] != "Some Release.2.mkv" || names[3] != "Some Release.3.mkv" {
+		t.Errorf("Expected the used filename to be skipped, got %v", names)
+	}
+
+	// no title, no names
+	nzb.Meta = nil
+
+	if names := nzb.ProposeFilenames(); len(names) != 0 {
+		t.Errorf("Expected no names without a title, got %v", names)
+	}
+}
+
+func TestFileLookup(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: `[1/3] "Release.rar" yEnc (1/1)`, Poster: "first"},
+			{Subject: `[2/3] "release.nfo" yEnc (1/1)`},
+			{Subject: `[3/3] "release.rar" yEnc (1/1)`, Poster: "second"},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	file, ok := nzb.FileByFilename("RELEASE.NFO")
+	if !ok || file.Filename != "release.nfo" {
+		t.Errorf("Expected to find release.nfo, got %v %v", file, ok)
+	}
+
+	// the first of several files with the same name is returned
+	file, ok = nzb.FileByFilename("release.rar")
+	if !ok || file.Poster != "first" {
+		t.Errorf("Expected the first matching file, got %v %v", file, ok)
+	}
+
+	if _, ok := nzb.FileByFilename("missing.rar"); ok {
+		t.Error("Expected no file for an unknown filename")
+	}
+
+	file, ok = nzb.FileByNumber(3)
+	if !ok || file.Poster != "second" {
+		t.Errorf("Expected file number 3, got %v %v", file, ok)
+	}
+
+	// changes through the returned pointer are kept
+	file.Poster = "changed"
+	if nzb.Files[2].Poster != "changed" {
+		t.Error("Expected the returned pointer to refer to the file in the nzb")
+	}
+
+	if _, ok := nzb.FileByNumber(4); ok {
+		t.Error("Expected no file for an unknown number")
+	}
+}
+
+func TestVolumeIndex(t *testing.T) {
+	cases := []struct {
+		filename string
+		index    int
+		ok       bool
+	}{
+		{"release.part01.rar", 0, true},
+		{"release.part10.RAR", 9, true},
+		{"release.part000.rar", 0, false},
+		{"release.rar", 0, true},
+		{"release.r00", 1, true},
+		{"release.r15", 16, true},
+		{"release.r100", 101, true},
+		{"release.7z", 0, true},
+		{"release.7z.001", 0, true},
+		{"release.7z.012", 11, true},
+		{"release.7z.000", 0, false},
+		{"release.par2", 0, false},
+		{"release.vol01+02.par2", 0, false},
+		{"release.mkv", 0, false},
+		{"release.zip", 0, false},
+		{"", 0, false},
+	}
+
+	for _, c := range cases {
+		file := NzbFile{Filename: c.filename}
+
+		index, ok := file.VolumeIndex()
+		if index != c.index || ok != c.ok {
+			t.Errorf("%q: got %d, %v want %d, %v", c.filename, index, ok, c.index, c.ok)
+		}
+	}
+}
+
+func TestFileTypeHelpers(t *testing.T) {
+	cases := []struct {
+		filename string
+		par2     bool
+		archive  bool
+		nfo      bool
+	}{
+		{"release.par2", true, false, false},
+		{"release.vol03+04.PAR2", true, false, false},
+		{"release.rar", false, true, false},
+		{"release.part01.rar", false, true, false},
+		{"release.r00", false, true, false},
+		{"release.zip", false, true, false},
+		{"release.7z", false, true, false},
+		{"release.7z.001", false, true, false},
+		{"release.nfo", false, false, true},
+		{"release.mkv", false, false, false},
+		{"", false, false, false},
+	}
+
+	for _, c := range cases {
+		file := NzbFile{Filename: c.filename}
+
+		if got := file.IsPar2(); got != c.par2 {
+			t.Errorf("%q: IsPar2 got %v want %v", c.filename, got, c.par2)
+		}
+		if got := file.IsArchive(); got != c.archive {
+			t.Errorf("%q: IsArchive got %v want %v", c.filename, got, c.archive)
+		}
+		if got := file.IsNfo(); got != c.nfo {
+			t.Errorf("%q: IsNfo got %v want %v", c.filename, got, c.nfo)
+		}
+	}
+}
+
+func TestFileExtension(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: `[1/3] "Release.Part01.RAR" yEnc (1/1)`},
+			{Subject: `[2/3] "release.vol00+01.par2" yEnc (1/1)`},
+			{Subject: `[3/3] "release" yEnc (1/1)`},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	for i, ext := range []string{"rar", "par2", ""} {
+		if got := nzb.Files[i].Extension(); got != ext {
+			t.Errorf("%q: extension got %q want %q", nzb.Files[i].Filename, got, ext)
+		}
+	}
+
+	// files without a basefilename use the last part of the filename
+	file := NzbFile{Filename: "movie.MKV"}
+	if got := file.Extension(); got != "mkv" {
+		t.Errorf("Expected extension mkv, got %q", got)
+	}
+}
+
+func TestGroupByBasefilename(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Basefilename: "release.part01"},
+			{Basefilename: "release.part02"},
+			{Basefilename: "release.r00"},
+			{Basefilename: "release.vol00+01"},
+			{Basefilename: "other"},
+			{Basefilename: ".part01"},
+		},
+	}
+
+	groups := nzb.GroupByBasefilename()
+
+	if len(groups) != 3 {
+		t.Fatalf("Expected 3 groups, got %d: %v", len(groups), groups)
+	}
+
+	release := groups["release"]
+	if len(release) != 4 || release[0].Basefilename != "release.part01" || release[2].Basefilename != "release.r00" {
+		t.Errorf("Unexpected release group: %+v", release)
+	}
+
+	if len(groups["other"]) != 1 {
+		t.Errorf("Expected 1 file for other, got %d", len(groups["other"]))
+	}
+
+	// files without a recognizable base keep their full basefilename
+	if len(groups[".part01"]) != 1 {
+		t.Errorf("Expected 1 file for .part01, got %d", len(groups[".part01"]))
+	}
+
+	// scanned subjects group the same way
+	nzb = &Nzb{
+		Files: []NzbFile{
+			{Subject: `[1/3] "release.part01.rar" yEnc (1/1)`},
+			{Subject: `[2/3] "release.r00" yEnc (1/1)`},
+			{Subject: `[3/3] "release.7z.001" yEnc (1/1)`},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	if got := len(nzb.GroupByBasefilename()["release"]); got != 3 {
+		t.Errorf("Expected 3 scanned files for release, got %d: %v", got, nzb.GroupByBasefilename())
+	}
+}
+
+func TestSuspiciousFiles(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: `[1/9] "release.part01.rar" yEnc (1/1)`},
+			{Subject: `[2/9] "release.part02.rar" yEnc (1/1)`},
+			{Subject: `[3/9] "release.txt" yEnc (1/1)`},
+			{Subject: `[4/9] "release.nfo" yEnc (1/1)`},
+			{Subject: `[5/9] "release.vol00+01.par2" yEnc (1/1)`},
+			{Subject: `[6/9] "movie.mkv" yEnc (1/1)`},
+			{Subject: `[7/9] "movie.srt" yEnc (1/1)`},
+			{Subject: `[8/9] "show.r00" yEnc (1/1)`},
+			{Subject: `[9/9] "show.mkv" yEnc (1/1)`},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	// a video with its subtitle and a single archive volume have too few siblings to be reported
+	indices := nzb.SuspiciousFiles()
+	if !reflect.DeepEqual(indices, []int{2}) {
+		t.Errorf("Expected suspicious files [2], got %v", indices)
+	}
+
+	if indices := (&Nzb{}).SuspiciousFiles(); len(indices) != 0 {
+		t.Errorf("Expected no suspicious files, got %v", indices)
+	}
+}
+
+func TestReleaseName(t *testing.T) {
+	files := []NzbFile{
+		{Subject: `[1/3] My.Release-GRP - "abc.part01.rar" yEnc (1/1)`},
+		{Subject: `[2/3] My.Release-GRP - "abc.part02.rar" yEnc (1/1)`},
+		{Subject: `[3/3] Other - "abc.par2" yEnc (1/1)`},
+	}
+
+	cases := []struct {
+		nzb      *Nzb
+		expected string
+	}{
+		// the meta data is preferred
+		{&Nzb{Meta: map[string]string{"name": " Meta.Name ", "title": "Meta Title"}, Files: files}, "Meta.Name"},
+		{&Nzb{Meta: map[string]string{"title": "Meta Title"}, Files: files}, "Meta Title"},
+		// the most common header
+		{&Nzb{Files: files}, "My.Release-GRP"},
+		// the header falls back to the basefilename without the volume suffix
+		{&Nzb{Files: []NzbFile{{Subject: `"release.vol00+01.par2" yEnc (1/1)`}, {Subject: `"release.r00" yEnc (1/1)`}}}, "release"},
+		// the common prefix of the basefilenames
+		{&Nzb{Files: []NzbFile{{Basefilename: "Some.Release.part01"}, {Basefilename: "Some.Release.part02"}, {}}}, "Some.Release"},
+		{&Nzb{Files: []NzbFile{{Basefilename: "abc"}, {Basefilename: "xyz"}}}, ""},
+		{&Nzb{}, ""},
+	}
+
+	for _, c := range cases {
+		if got := c.nzb.ReleaseName(); got != c.expected {
+			t.Errorf("Expected release name %q, got %q for %+v", c.expected, got, c.nzb.Files)
+		}
+	}
+
+	if got := commonPrefix("Stück.1", "Stöck.2"); got != "St" {
+		t.Errorf("Expected the common prefix to keep whole characters, got %q", got)
+	}
+}
+
+func TestPartNumber(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: `[3/12] "release.part01.rar" yEnc (1/1)`},
+			{Subject: `[7/12] "release.r00" yEnc (1/1)`},
+			{Subject: `"release.nfo" yEnc (1/1)`},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	// the part number follows the subject, not the volume order
+	index, _ := nzb.Files[0].VolumeIndex()
+	if part := nzb.Files[0].PartNumber(); part != 3 || index != 0 {
+		t.Errorf("Expected part number 3 for volume 0, got %d for volume %d", part, index)
+	}
+
+	if got := nzb.Files[1].PartNumber(); got != 7 {
+		t.Errorf("Expected part number 7, got %d", got)
+	}
+
+	if got := nzb.MaxPartNumber(); got != 7 {
+		t.Errorf("Expected max part number 7, got %d", got)
+	}
+
+	if got := (&Nzb{}).MaxPartNumber(); got != 0 {
+		t.Errorf("Expected max part number 0, got %d", got)
+	}
+}
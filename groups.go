@@ -0,0 +1,97 @@
+package nzbparser
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// returns the sorted union of the groups of all files
+// surrounding whitespace is trimmed and empty groups are skipped, the comparison is case-sensitive like newsgroup names
+func (n *Nzb) AllGroups() []string {
+	seen := make(map[string]struct{})
+
+	var groups []string
+
+	for _, file := range n.Files {
+		for _, group := range file.Groups {
+			group = strings.TrimSpace(group)
+			if group == "" {
+				continue
+			}
+
+			if _, ok := seen[group]; !ok {
+				seen[group] = struct{}{}
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	sort.Strings(groups)
+
+	return groups
+}
+
+// returns the files of each group, a file is listed under each of its groups in the order of the nzb
+// group names are trimmed and empty groups are skipped like with AllGroups
+func (n *Nzb) FilesByGroup() map[string]NzbFiles {
+	groups := make(map[string]NzbFiles)
+
+	for _, file := range n.Files {
+		for _, group := range normalizeGroups(file.Groups) {
+			groups[group] = append(groups[group], file)
+		}
+	}
+
+	return groups
+}
+
+// returns the group with the most files or an empty string if no file has a group
+// groups with the same number of files are decided by their name in sort order
+func (n *Nzb) PrimaryGroup() string {
+	counts := make(map[string]int)
+
+	for _, file := range n.Files {
+		for _, group := range normalizeGroups(file.Groups) {
+			counts[group]++
+		}
+	}
+
+	primary := ""
+
+	for group, count := range counts {
+		if count > counts[primary] || (count == counts[primary] && group < primary) {
+			primary = group
+		}
+	}
+
+	return primary
+}
+
+// returns true if the file is posted to the given group, surrounding whitespace is ignored
+func (f *NzbFile) HasGroup(name string) bool {
+	name = strings.TrimSpace(name)
+
+	for _, group := range f.Groups {
+		if strings.TrimSpace(group) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns a sorted copy of the groups without duplicates, surrounding whitespace is trimmed and empty groups are skipped
+func normalizeGroups(groups []string) []string {
+	normalized := make([]string, 0, len(groups))
+
+	for _, group := range groups {
+		if group = strings.TrimSpace(group); group != "" {
+			normalized = append(normalized, group)
+		}
+	}
+
+	sort.Strings(normalized)
+
+	return slices.Compact(normalized)
+}
@@ -0,0 +1,79 @@
+package nzbparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllGroups(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Groups: []string{"alt.binaries.test", " alt.binaries.misc\n"}},
+			{Groups: []string{"alt.binaries.misc", "Alt.Binaries.Test", ""}},
+			{},
+		},
+	}
+
+	expected := []string{"Alt.Binaries.Test", "alt.binaries.misc", "alt.binaries.test"}
+	if groups := nzb.AllGroups(); !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Expected groups %v, got %v", expected, groups)
+	}
+
+	if groups := (&Nzb{}).AllGroups(); len(groups) != 0 {
+		t.Errorf("Expected no groups for an empty nzb, got %v", groups)
+	}
+}
+
+func TestHasGroup(t *testing.T) {
+	file := NzbFile{Groups: []string{"alt.binaries.test", " alt.binaries.misc "}}
+
+	if !file.HasGroup("alt.binaries.test") || !file.HasGroup("alt.binaries.misc") {
+		t.Error("Expected file to be posted to both groups")
+	}
+
+	if file.HasGroup("Alt.Binaries.Test") || file.HasGroup("alt.binaries.other") {
+		t.Error("Expected group lookup to be case-sensitive and exact")
+	}
+}
+
+func TestFilesByGroup(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: "a", Groups: []string{"alt.binaries.test", " alt.binaries.misc\n", "alt.binaries.test"}},
+			{Subject: "b", Groups: []string{"alt.binaries.misc", ""}},
+			{Subject: "c"},
+		},
+	}
+
+	subjects := make(map[string][]string)
+	for group, files := range nzb.FilesByGroup() {
+		for _, file := range files {
+			subjects[group] = append(subjects[group], file.Subject)
+		}
+	}
+
+	expected := map[string][]string{
+		"alt.binaries.misc": {"a", "b"},
+		"alt.binaries.test": {"a"},
+	}
+
+	if !reflect.DeepEqual(subjects, expected) {
+		t.Errorf("Expected files by group %v, got %v", expected, subjects)
+	}
+
+	if got := nzb.PrimaryGroup(); got != "alt.binaries.misc" {
+		t.Errorf("Expected primary group alt.binaries.misc, got %q", got)
+	}
+
+	// ties are decided by the name
+	nzb.Files[0].Groups = []string{"alt.binaries.test"}
+	nzb.Files[1].Groups = []string{"alt.binaries.misc"}
+
+	if got := nzb.PrimaryGroup(); got != "alt.binaries.misc" {
+		t.Errorf("Expected primary group alt.binaries.misc on a tie, got %q", got)
+	}
+
+	if got := (&Nzb{Files: []NzbFile{{}}}).PrimaryGroup(); got != "" {
+		t.Errorf("Expected no primary group, got %q", got)
+	}
+}
@@ -0,0 +1,41 @@
+package nzbparser
+
+import (
+	"encoding/json"
+)
+
+// nzb type without methods for (un)marshalling the fields with their json tags
+type jsonNzb Nzb
+
+// marshal the nzb to json, a nil meta map is written as an empty object
+func (n *Nzb) MarshalJSON() ([]byte, error) {
+	meta := n.Meta
+	if meta == nil {
+		meta = make(map[string]string)
+	}
+
+	return json.Marshal(&struct {
+		Meta map[string]string `json:"meta"`
+		*jsonNzb
+	}{
+		Meta:    meta,
+		jsonNzb: (*jsonNzb)(n),
+	})
+}
+
+// unmarshal the nzb from json, the meta maps are always initialized like with Parse
+func (n *Nzb) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*jsonNzb)(n)); err != nil {
+		return err
+	}
+
+	if n.Meta == nil {
+		n.Meta = make(map[string]string)
+	}
+
+	if n.MetaMulti == nil {
+		n.MetaMulti = make(map[string][]string)
+	}
+
+	return nil
+}
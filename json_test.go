@@ -0,0 +1,96 @@
+package nzbparser
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	validNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <head>
+    <meta type="title">Test Title</meta>
+  </head>
+  <file poster="test@example.com" date="1234567890" subject="[1/2] Test - &quot;a.rar&quot; yEnc (1/3)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="1">a-1@example</segment>
+      <segment bytes="200" number="2">a-2@example</segment>
+    </segments>
+  </file>
+  <file poster="test@example.com" date="1234567891" subject="[2/2] Test - &quot;a.par2&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="300" number="1">b-1@example</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	nzb, err := ParseString(validNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	data, err := json.Marshal(nzb)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+
+	for _, field := range []string{`"meta":{"title":"Test Title"}`, `"total_files":2`, `"segments":3`, `"total_segments":4`, `"bytes":600`, `"date":1234567890`, `"id":"a-1@example"`} {
+		if !strings.Contains(string(data), field) {
+			t.Errorf("Expected JSON to contain %s, got %s", field, data)
+		}
+	}
+
+	// the positions of the parsed elements are internal and not part of the json
+	if strings.Contains(string(data), "position") {
+		t.Errorf("Expected JSON without positions, got %s", data)
+	}
+
+	for id := range nzb.Files {
+		nzb.Files[id].position = 0
+
+		for sid := range nzb.Files[id].Segments {
+			nzb.Files[id].Segments[sid].position = 0
+		}
+	}
+
+	var decoded Nzb
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(nzb, &decoded) {
+		t.Errorf("JSON round-trip mismatch:\n%+v\n%+v", nzb, &decoded)
+	}
+
+	// rescanning the decoded nzb reproduces the computed totals
+	ScanNzbFile(&decoded)
+
+	if decoded.TotalFiles != nzb.TotalFiles || decoded.Segments != nzb.Segments || decoded.TotalSegments != nzb.TotalSegments || decoded.Bytes != nzb.Bytes {
+		t.Errorf("Totals differ after ScanNzbFile: got %d/%d/%d/%d, expected %d/%d/%d/%d",
+			decoded.TotalFiles, decoded.Segments, decoded.TotalSegments, decoded.Bytes,
+			nzb.TotalFiles, nzb.Segments, nzb.TotalSegments, nzb.Bytes)
+	}
+}
+
+func TestJSONEmptyMeta(t *testing.T) {
+	data, err := json.Marshal(&Nzb{})
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+
+	if !strings.Contains(string(data), `"meta":{}`) {
+		t.Errorf("Expected nil meta to be written as an empty object, got %s", data)
+	}
+
+	var nzb Nzb
+	if err := json.Unmarshal([]byte(`{"files":[]}`), &nzb); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+
+	if nzb.Meta == nil {
+		t.Error("Expected meta map to be initialized")
+	}
+}
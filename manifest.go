@@ -0,0 +1,48 @@
+package nzbparser
+
+import (
+	"strings"
+)
+
+// segment of a flat download list as returned by Manifest
+type ManifestEntry struct {
+	Filename      string // filename of the file as computed by ScanNzbFile
+	SegmentNumber int    // number of the segment within the file
+	MessageID     string // message-id of the segment
+	Bytes         int64  // size of the segment
+	Group         string // first group of the file (empty if it has none)
+}
+
+// returns one entry per segment in the order of the files and their segments
+// relies on the filenames as computed by ScanNzbFile
+func (n *Nzb) Manifest() []ManifestEntry {
+	var entries []ManifestEntry
+
+	for id := range n.Files {
+		file := &n.Files[id]
+		group := firstGroup(file.Groups)
+
+		for _, segment := range file.Segments {
+			entries = append(entries, ManifestEntry{
+				Filename:      file.Filename,
+				SegmentNumber: segment.Number,
+				MessageID:     segment.ID,
+				Bytes:         segment.Bytes,
+				Group:         group,
+			})
+		}
+	}
+
+	return entries
+}
+
+// returns the first non-empty group with whitespace trimmed like with AllGroups
+func firstGroup(groups []string) string {
+	for _, group := range groups {
+		if group = strings.TrimSpace(group); group != "" {
+			return group
+		}
+	}
+
+	return ""
+}
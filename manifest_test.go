@@ -0,0 +1,39 @@
+package nzbparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{
+				Subject:  `[1/2] "release.rar" yEnc (1/2)`,
+				Groups:   []string{" ", " alt.binaries.test ", "alt.binaries.misc"},
+				Segments: []NzbSegment{{Number: 1, Bytes: 100, ID: "a-1@test"}, {Number: 2, Bytes: 50, ID: "a-2@test"}},
+			},
+			{
+				Subject:  `[2/2] "release.par2" yEnc (1/1)`,
+				Segments: []NzbSegment{{Number: 1, Bytes: 10, ID: "b-1@test"}},
+			},
+			{Subject: `"empty.nfo" yEnc (1/1)`},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	expected := []ManifestEntry{
+		{Filename: "release.rar", SegmentNumber: 1, MessageID: "a-1@test", Bytes: 100, Group: "alt.binaries.test"},
+		{Filename: "release.rar", SegmentNumber: 2, MessageID: "a-2@test", Bytes: 50, Group: "alt.binaries.test"},
+		{Filename: "release.par2", SegmentNumber: 1, MessageID: "b-1@test", Bytes: 10},
+	}
+
+	if entries := nzb.Manifest(); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Expected manifest %+v, got %+v", expected, entries)
+	}
+
+	if entries := (&Nzb{}).Manifest(); len(entries) != 0 {
+		t.Errorf("Expected an empty manifest, got %+v", entries)
+	}
+}
@@ -0,0 +1,213 @@
+package nzbparser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// password embedded in a filename, e.g. releasename{{password}}.rar
+	filenamePasswordRE = regexp.MustCompile(`\{\{(.+?)\}\}`)
+	// password stated in the comment as "password: secret" or "pw: secret", the rest of the line is the password
+	commentPasswordRE = regexp.MustCompile(`(?im)(?:^|[^a-z])(?:password|pw)[ \t]*:[ \t]*(\S.*?)[ \t]*$`)
+)
+
+// case-insensitive lookup of a meta data value
+func metaValue(meta map[string]string, key string) (string, bool) {
+	if value, ok := meta[key]; ok {
+		return value, true
+	}
+
+	for k, value := range meta {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// set the meta data value of the type, replacing all previous values of it
+// the meta maps are created if nil, concurrent calls of SetMeta, AddMeta and GetMeta are safe
+func (n *Nzb) SetMeta(key, value string) {
+	c := n.cache()
+
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+
+	n.initMeta()
+
+	n.Meta[key] = value
+	n.MetaMulti[key] = []string{value}
+}
+
+// add a meta data value to the type, keeping its previous values
+// the first value of a type stays the one of Meta, the meta maps are created if nil
+func (n *Nzb) AddMeta(key, value string) {
+	c := n.cache()
+
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+
+	n.initMeta()
+
+	first, ok := n.Meta[key]
+	if !ok {
+		n.Meta[key] = value
+		n.MetaMulti[key] = append(n.MetaMulti[key], value)
+
+		return
+	}
+
+	// keep the value of Meta if MetaMulti doesn't know about it yet
+	if len(n.MetaMulti[key]) == 0 {
+		n.MetaMulti[key] = []string{first}
+	}
+
+	n.MetaMulti[key] = append(n.MetaMulti[key], value)
+}
+
+// returns the (first) meta data value of the type with a case-insensitive lookup of the type
+func (n *Nzb) GetMeta(key string) (string, bool) {
+	c := n.cache()
+
+	c.metaMu.RLock()
+	defer c.metaMu.RUnlock()
+
+	return metaValue(n.Meta, key)
+}
+
+// returns the title meta data or an empty string
+func (n *Nzb) Title() string {
+	return n.metaString("title")
+}
+
+// returns the name meta data of indexers, falling back to the propername meta data, or an empty string
+func (n *Nzb) Name() string {
+	if name := n.metaString("name"); name != "" {
+		return name
+	}
+
+	return n.metaString("propername")
+}
+
+// returns the category meta data or an empty string
+func (n *Nzb) Category() string {
+	return n.metaString("category")
+}
+
+// returns the season meta data as number, given as 3, 03 or S03, ok is false if it is absent or not a number
+func (n *Nzb) Season() (int, bool) {
+	return n.metaNumber("season", "s")
+}
+
+// returns the episode meta data as number, given as 7, 07 or E07, ok is false if it is absent or not a number
+func (n *Nzb) Episode() (int, bool) {
+	return n.metaNumber("episode", "e")
+}
+
+// returns the trimmed meta data value of the type or an empty string
+func (n *Nzb) metaString(key string) string {
+	value, _ := n.GetMeta(key)
+	return strings.TrimSpace(value)
+}
+
+// returns the meta data value of the type as non-negative number, an optional prefix is ignored case-insensitively
+func (n *Nzb) metaNumber(key, prefix string) (int, bool) {
+	value := n.metaString(key)
+	if len(value) > len(prefix) && strings.EqualFold(value[:len(prefix)], prefix) {
+		value = value[len(prefix):]
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 0 {
+		return 0, false
+	}
+
+	return number, true
+}
+
+// remove the meta data of all types not in keep, the types are compared case-insensitively
+func (n *Nzb) StripMeta(keep ...string) {
+	c := n.cache()
+
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+
+	kept := func(key string) bool {
+		for _, k := range keep {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for key := range n.Meta {
+		if !kept(key) {
+			delete(n.Meta, key)
+		}
+	}
+
+	for key := range n.MetaMulti {
+		if !kept(key) {
+			delete(n.MetaMulti, key)
+		}
+	}
+}
+
+// remove the information identifying the poster before sharing the nzb
+// all meta data except title and category, the poster of every file and the comments are removed
+func (n *Nzb) Anonymize() {
+	n.StripMeta("title", "category")
+
+	for id := range n.Files {
+		n.Files[id].Poster = ""
+	}
+
+	n.Comment = ""
+	n.HeadComments = nil
+}
+
+// create the meta maps if nil
+func (n *Nzb) initMeta() {
+	if n.Meta == nil {
+		n.Meta = make(map[string]string)
+	}
+
+	if n.MetaMulti == nil {
+		n.MetaMulti = make(map[string][]string)
+	}
+}
+
+// returns the password embedded in the filename as {{password}} or an empty string
+func (f *NzbFile) ExtractPassword() string {
+	if matches := filenamePasswordRE.FindStringSubmatch(f.Filename); matches != nil {
+		return strings.TrimSpace(matches[1])
+	}
+
+	return ""
+}
+
+// find the password of the nzb
+// the password meta tag takes precedence over a password stated in the comment, which takes precedence over
+// passwords embedded in the filenames
+func findPassword(nzb *Nzb) string {
+	if password, ok := metaValue(nzb.Meta, "password"); ok && strings.TrimSpace(password) != "" {
+		return strings.TrimSpace(password)
+	}
+
+	if matches := commentPasswordRE.FindStringSubmatch(nzb.Comment); matches != nil {
+		return matches[1]
+	}
+
+	for id := range nzb.Files {
+		if password := nzb.Files[id].ExtractPassword(); password != "" {
+			return password
+		}
+	}
+
+	return ""
+}
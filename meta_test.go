@@ -0,0 +1,388 @@
+package nzbparser
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPassword(t *testing.T) {
+	metaNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <head>
+    <meta type="Password">secret</meta>
+  </head>
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Release - &quot;release{{other}}.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a-1</segment></segments>
+  </file>
+</nzb>`
+
+	nzb, err := ParseString(metaNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	// the meta tag is preferred and looked up case-insensitively
+	if nzb.Password != "secret" {
+		t.Errorf("Expected password 'secret', got %q", nzb.Password)
+	}
+
+	// the filename password stays available on the file
+	if password := nzb.Files[0].ExtractPassword(); password != "other" {
+		t.Errorf("Expected filename password 'other', got %q", password)
+	}
+
+	filenameNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Release - &quot;release{{hunter2}}.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a-1</segment></segments>
+  </file>
+</nzb>`
+
+	nzb, err = ParseString(filenameNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if nzb.Password != "hunter2" {
+		t.Errorf("Expected password 'hunter2' from the filename, got %q", nzb.Password)
+	}
+
+	commentNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <!-- posted by someone
+       PW: hunter2 -->
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Release - &quot;release{{other}}.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a-1</segment></segments>
+  </file>
+</nzb>`
+
+	nzb, err = ParseString(commentNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	// the comment is preferred over the filename
+	if nzb.Password != "hunter2" {
+		t.Errorf("Expected password 'hunter2' from the comment, got %q", nzb.Password)
+	}
+
+	for comment, expected := range map[string]string{
+		"password: top secret ": "top secret",
+		"Password:secret":       "secret",
+		"no password here":      "",
+		"password:":             "",
+		"newzbin: 1":            "",
+	} {
+		if password := findPassword(&Nzb{Comment: comment}); password != expected {
+			t.Errorf("%q: expected password %q, got %q", comment, expected, password)
+		}
+	}
+
+	file := NzbFile{Filename: "release.rar"}
+	if password := file.ExtractPassword(); password != "" {
+		t.Errorf("Expected no password, got %q", password)
+	}
+}
+
+func TestMultiValueMeta(t *testing.T) {
+	multiNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <head>
+    <meta type="title">Release</meta>
+    <meta type="tag">action</meta>
+    <meta type="tag">comedy</meta>
+    <meta type="tag">drama</meta>
+  </head>
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Release - &quot;release.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a-1</segment></segments>
+  </file>
+</nzb>`
+
+	nzb, err := ParseString(multiNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	// Meta keeps the first value
+	if nzb.Meta["tag"] != "action" || nzb.Meta["title"] != "Release" {
+		t.Errorf("Unexpected meta %v", nzb.Meta)
+	}
+
+	if tags := nzb.MetaMulti["tag"]; len(tags) != 3 || tags[0] != "action" || tags[1] != "comedy" || tags[2] != "drama" {
+		t.Errorf("Expected all tag values, got %v", tags)
+	}
+
+	// all values survive a round-trip
+	output, err := WriteString(nzb)
+	if err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+
+	for _, element := range []string{`<meta type="tag">action</meta>`, `<meta type="tag">comedy</meta>`, `<meta type="tag">drama</meta>`} {
+		if strings.Count(output, element) != 1 {
+			t.Errorf("Expected output to contain %s once, got:\n%s", element, output)
+		}
+	}
+
+	parsed, err := ParseString(output)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(parsed.MetaMulti, nzb.MetaMulti) {
+		t.Errorf("Multi-value meta differs after round-trip: %v vs %v", parsed.MetaMulti, nzb.MetaMulti)
+	}
+
+	// Meta decides the written types and the first value
+	nzb.Meta["tag"] = "thriller"
+	delete(nzb.Meta, "title")
+
+	output, err = WriteString(nzb)
+	if err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+
+	if strings.Contains(output, `type="title"`) || strings.Contains(output, `>action<`) || !strings.Contains(output, `<meta type="tag">thriller</meta>`) || !strings.Contains(output, `<meta type="tag">comedy</meta>`) {
+		t.Errorf("Unexpected meta output:\n%s", output)
+	}
+
+	// MetaMulti alone is written if there is no Meta
+	output, err = WriteString(&Nzb{MetaMulti: map[string][]string{"tag": {"a", "b"}}})
+	if err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+
+	if !strings.Contains(output, `<meta type="tag">a</meta>`) || !strings.Contains(output, `<meta type="tag">b</meta>`) {
+		t.Errorf("Expected MetaMulti values in output:\n%s", output)
+	}
+}
+
+func TestMetaAccessors(t *testing.T) {
+	// an nzb built from scratch without meta maps
+	nzb := &Nzb{}
+
+	nzb.SetMeta("title", "Release")
+	if nzb.Meta["title"] != "Release" || len(nzb.MetaMulti["title"]) != 1 {
+		t.Errorf("Expected title meta to be set, got %v and %v", nzb.Meta, nzb.MetaMulti)
+	}
+
+	nzb.AddMeta("title", "Release Alternative")
+	if nzb.Meta["title"] != "Release" {
+		t.Errorf("Expected AddMeta to keep the first value, got %q", nzb.Meta["title"])
+	}
+
+	if values := nzb.MetaMulti["title"]; len(values) != 2 || values[1] != "Release Alternative" {
+		t.Errorf("Expected both title values, got %v", values)
+	}
+
+	nzb.SetMeta("title", "Replaced")
+	if values := nzb.MetaMulti["title"]; len(values) != 1 || values[0] != "Replaced" || nzb.Meta["title"] != "Replaced" {
+		t.Errorf("Expected SetMeta to replace all values, got %q and %v", nzb.Meta["title"], values)
+	}
+
+	nzb.AddMeta("Password", "secret")
+	if value, ok := nzb.GetMeta("password"); !ok || value != "secret" {
+		t.Errorf("Expected case-insensitive lookup of the password, got %q %v", value, ok)
+	}
+
+	if _, ok := nzb.GetMeta("missing"); ok {
+		t.Error("Expected no value for a missing type")
+	}
+
+	// meta only set directly in Meta keeps its value when adding to it
+	nzb = &Nzb{Meta: map[string]string{"tag": "first"}}
+	nzb.AddMeta("tag", "second")
+
+	if values := nzb.MetaMulti["tag"]; len(values) != 2 || values[0] != "first" || values[1] != "second" {
+		t.Errorf("Expected tag values [first second], got %v", values)
+	}
+}
+
+func TestMetaAccessorsConcurrent(t *testing.T) {
+	nzb := &Nzb{}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			nzb.AddMeta("tag", fmt.Sprintf("value-%d", i))
+			nzb.SetMeta(fmt.Sprintf("key-%d", i), "value")
+			_, _ = nzb.GetMeta("tag")
+		}(i)
+	}
+
+	wg.Wait()
+
+	if len(nzb.MetaMulti["tag"]) != 10 || len(nzb.Meta) != 11 {
+		t.Errorf("Expected all concurrent meta values, got %v", nzb.MetaMulti)
+	}
+}
+
+func TestMetaEscaping(t *testing.T) {
+	builder := NewBuilder().SetMeta("title", "A & B <c>")
+	builder.AddFile("poster@example.com", time.Time{}, `"file.rar" yEnc (1/1)`, []string{"alt.test"}).AddSegment(1, 100, "a-1@example")
+
+	nzb := builder.Build()
+	nzb.AddMeta("tag", "x&y")
+	nzb.AddMeta("tag", "<z>")
+
+	output, err := WriteString(nzb)
+	if err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+
+	if !strings.Contains(output, "A &amp; B &lt;c&gt;") {
+		t.Errorf("Expected the escaped title in the output:\n%s", output)
+	}
+
+	parsed, err := ParseString(output)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if title := parsed.Title(); title != "A & B <c>" {
+		t.Errorf("Expected the title to round-trip, got %q", title)
+	}
+
+	if values := parsed.MetaMulti["tag"]; !reflect.DeepEqual(values, []string{"x&y", "<z>"}) {
+		t.Errorf("Expected the tag values to round-trip, got %v", values)
+	}
+
+	// parsed meta data is unescaped, also within cdata sections
+	parsed, err = ParseString(`<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <head>
+    <meta type="title">A &amp; B</meta>
+    <meta type="category"><![CDATA[TV & Movies]]></meta>
+  </head>
+  <file poster="poster" date="1" subject="&quot;file.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a-1@example</segment></segments>
+  </file>
+</nzb>`)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if title, category := parsed.Title(), parsed.Category(); title != "A & B" || category != "TV & Movies" {
+		t.Errorf("Expected the unescaped meta data, got %q and %q", title, category)
+	}
+}
+
+func TestStripMeta(t *testing.T) {
+	nzb := &Nzb{
+		Meta:      map[string]string{"Title": "Release", "category": "TV", "poster": "someone@example.com"},
+		MetaMulti: map[string][]string{"Title": {"Release"}, "category": {"TV"}, "poster": {"someone@example.com"}},
+	}
+
+	nzb.StripMeta("title", "CATEGORY")
+
+	expected := map[string]string{"Title": "Release", "category": "TV"}
+	if !reflect.DeepEqual(nzb.Meta, expected) {
+		t.Errorf("Expected meta %v, got %v", expected, nzb.Meta)
+	}
+
+	if _, ok := nzb.MetaMulti["poster"]; ok || len(nzb.MetaMulti) != 2 {
+		t.Errorf("Expected the poster to be removed from all values, got %v", nzb.MetaMulti)
+	}
+
+	nzb.StripMeta()
+	if len(nzb.Meta) != 0 || len(nzb.MetaMulti) != 0 {
+		t.Errorf("Expected all meta to be removed, got %v and %v", nzb.Meta, nzb.MetaMulti)
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	nzb, err := ParseString(`<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <!-- posted by someone@example.com -->
+  <head>
+    <meta type="title">Release</meta>
+    <meta type="category">TV</meta>
+    <meta type="poster">someone@example.com</meta>
+  </head>
+  <file poster="someone@example.com" date="1" subject="&quot;file.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a@test</segment></segments>
+  </file>
+</nzb>`)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	nzb.Anonymize()
+
+	output, err := WriteString(nzb)
+	if err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+
+	if strings.Contains(output, "someone") {
+		t.Errorf("Expected the poster to be removed:\n%s", output)
+	}
+
+	if !strings.Contains(output, `<meta type="title">Release</meta>`) || !strings.Contains(output, `<meta type="category">TV</meta>`) {
+		t.Errorf("Expected title and category to be kept:\n%s", output)
+	}
+}
+
+func TestTypedMeta(t *testing.T) {
+	nzb := &Nzb{Meta: map[string]string{
+		"Title":    " Release Title ",
+		"category": "TV > HD",
+		"name":     "Release.Name.S03E07",
+		"SEASON":   "S03",
+		"episode":  "07",
+	}}
+
+	if got := nzb.Title(); got != "Release Title" {
+		t.Errorf("Expected title 'Release Title', got %q", got)
+	}
+
+	if got := nzb.Category(); got != "TV > HD" {
+		t.Errorf("Expected category 'TV > HD', got %q", got)
+	}
+
+	if got := nzb.Name(); got != "Release.Name.S03E07" {
+		t.Errorf("Expected name 'Release.Name.S03E07', got %q", got)
+	}
+
+	if season, ok := nzb.Season(); !ok || season != 3 {
+		t.Errorf("Expected season 3, got %d %v", season, ok)
+	}
+
+	if episode, ok := nzb.Episode(); !ok || episode != 7 {
+		t.Errorf("Expected episode 7, got %d %v", episode, ok)
+	}
+
+	// the propername is used without name
+	nzb = &Nzb{Meta: map[string]string{"propername": "Proper Name", "season": "three", "episode": "-1"}}
+
+	if got := nzb.Name(); got != "Proper Name" {
+		t.Errorf("Expected name 'Proper Name', got %q", got)
+	}
+
+	if season, ok := nzb.Season(); ok || season != 0 {
+		t.Errorf("Expected no season for a non-numeric value, got %d %v", season, ok)
+	}
+
+	if episode, ok := nzb.Episode(); ok || episode != 0 {
+		t.Errorf("Expected no episode for a negative value, got %d %v", episode, ok)
+	}
+
+	// absent meta data
+	empty := &Nzb{}
+	if empty.Title() != "" || empty.Name() != "" || empty.Category() != "" {
+		t.Error("Expected empty strings without meta data")
+	}
+
+	if _, ok := empty.Season(); ok {
+		t.Error("Expected no season without meta data")
+	}
+}
@@ -1,38 +1,142 @@
 package nzbparser
 
 import (
+	"archive/zip"
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"html"
 	"io"
+	"os"
+	"runtime"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unsafe"
 
 	"golang.org/x/net/html/charset"
 )
 
 const (
+	// xml declaration of nzb files
+	xmlDeclaration = `<?xml version="1.0" encoding="utf-8" ?>` + "\n"
+	// document type declaration of nzb files
+	doctype = `<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">` + "\n"
 	// xml header for nzb files
-	Header = `<?xml version="1.0" encoding="utf-8" ?>
-<!DOCTYPE nzb PUBLIC "-//newzBin//DTD NZB 1.1//EN" "http://www.newzbin.com/DTD/nzb/nzb-1.1.dtd">` + "\n"
+	Header = xmlDeclaration + doctype
 	// xml namespace for nzb files
 	Xmlns = "http://www.newzbin.com/DTD/2003/nzb"
 )
 
 // ParseOptions allows configuration of the NZB parsing behavior
 type ParseOptions struct {
-	RemoveDuplicates bool // whether to remove duplicate files and segments
+	RemoveDuplicates         bool             // whether to remove duplicate files and segments
+	KeepRawMessageIDs        bool             // whether to keep the surrounding angle brackets of segment message-ids, whitespace is always removed
+	MergeDuplicateFiles      bool             // whether to merge the segments of duplicate files into the first occurrence instead of discarding them (with RemoveDuplicates)
+	PreferLargerSegments     bool             // whether to keep the duplicate segment with the most bytes instead of the first one (with RemoveDuplicates)
+	DedupKey                 DedupKey         // key identifying duplicate files (with RemoveDuplicates)
+	SortBy                   SortBy           // order of the files after parsing
+	NoSort                   bool             // whether to keep the files and segments in the order of the input (same as SortByNone)
+	DisableGzip              bool             // whether to turn off the transparent decompression of gzip input detected by its magic bytes
+	MaxBytes                 int64            // maximum size of the (decompressed) input in bytes, 0 means unlimited
+	MaxFiles                 int              // maximum number of files, 0 means unlimited
+	MaxSegmentsPerFile       int              // maximum number of segments of a single file, 0 means unlimited
+	Parallel                 bool             // whether to scan the files concurrently, worth it for nzbs with many files
+	GlobalDedup              bool             // whether to remove segments whose message-id is already part of an earlier file
+	ForceCharset             string           // charset to decode the input from regardless of the xml declaration (e.g. windows-1252), empty to detect it
+	SubjectCache             *SubjectCache    // cache of the parsed subjects shared between several parses, nil to parse every subject
+	RejectZeroBytes          bool             // whether to return ErrNoPayload if the segments of all files have a total of 0 bytes
+	TrustSubjectSegmentTotal bool             // whether the segment total of a subject is taken even if segments with higher numbers are present
+	SkipMalformedFiles       bool             // whether to skip files which fail to decode instead of failing, ParseVerbose reports them as warnings
+	ValidateMessageIDs       bool             // whether to drop segments whose message-id fails IsValidMessageID, ParseVerbose reports them as warnings
+	CaseFoldSegmentIDs       bool             // whether segment message-ids differing only in case are duplicates (with RemoveDuplicates and GlobalDedup), the kept segment keeps its id
+	Validator                func(*Nzb) error // called last with the deduplicated, scanned and sorted nzb, an error rejects the nzb wrapped in ErrRejected
+}
+
+// SortBy selects the order of the files after parsing
+type SortBy int
+
+const (
+	SortByNumber   SortBy = iota // sort the files by their file number and the segments by their number (default)
+	SortByFilename               // sort the files by their filename with par2 files last and the segments by their number
+	SortByNone                   // keep the files and segments in the order of the input
+)
+
+// DedupKey selects the key identifying duplicate files when removing duplicates
+type DedupKey int
+
+const (
+	DedupBySubject    DedupKey = iota // files with the same subject are duplicates (default)
+	DedupByFilename                   // files with the same filename as parsed from the subject are duplicates, the subject is used without filename
+	DedupBySegmentSet                 // files with the same set of segment message-ids are duplicates, the subject is used without segments
+)
+
+// WriteOptions allows configuration of the NZB writing behavior
+type WriteOptions struct {
+	Validate           bool   // whether to reject nzbs with structural problems as reported by Validate
+	Indent             string // indentation of the xml elements, two spaces if empty
+	Compact            bool   // whether to write the xml elements without any indentation and line breaks
+	OmitHeader         bool   // whether to leave out the DOCTYPE declaration of the Header
+	OmitXMLDeclaration bool   // whether to leave out the xml declaration of the Header
+	SegmentNumberFirst bool   // whether to write the number attribute of the segments before the bytes attribute
+	KeepSegmentOrder   bool   // whether to write the segments in their order instead of sorted by number
+	SortFiles          bool   // whether to write the files sorted by number instead of in their order
+	NormalizeGroups    bool   // whether to write the groups of each file sorted and without duplicates
+	PreserveInputOrder bool   // whether to write the files and segments in the order of the parsed nzb, takes precedence over the sort options if the positions are known
+	Header             string // written verbatim instead of Header and the omit options if set, the body stays utf-8 so the header must match that encoding
 }
 
 // nzb file structure with additional information
 type Nzb struct {
-	Comment       string            // comment tag
-	Meta          map[string]string // meta data as map
-	Files         NzbFiles          // files structure
-	TotalFiles    int               // number of total files
-	Segments      int               // number of available segments
-	TotalSegments int               // number of total segments
-	Bytes         int64             // total size of all files
+	Comment       string              `json:"comment"`                 // comment tag
+	Meta          map[string]string   `json:"meta"`                    // meta data as map (first value of each type)
+	MetaMulti     map[string][]string `json:"meta_multi"`              // all meta data values of each type
+	Files         NzbFiles            `json:"files"`                   // files structure
+	TotalFiles    int                 `json:"total_files"`             // number of total files
+	Segments      int                 `json:"segments"`                // number of available segments
+	TotalSegments int                 `json:"total_segments"`          // number of total segments
+	Bytes         int64               `json:"bytes"`                   // total size of all files
+	TotalBytes    int64               `json:"total_bytes"`             // estimated size of all files including the missing segments, equals Bytes if complete
+	Password      string              `json:"password"`                // password of the release (from the meta data, the comment or a filename)
+	Namespace     string              `json:"namespace"`               // xml namespace of the root element (empty if absent), written instead of Xmlns if set
+	HeadComments  []string            `json:"head_comments,omitempty"` // comments within the head element, written before the meta data
+
+	lazy unsafe.Pointer // *nzbCache with the locks and caches, created on the first use so the nzb can still be copied
+}
+
+// locks and lazily built caches of an nzb, shared by the copies of an nzb value
+type nzbCache struct {
+	metaMu sync.RWMutex // guards Meta and MetaMulti within SetMeta, AddMeta and GetMeta
+
+	indexMu      sync.Mutex                 // guards segmentIndex and indexFiles
+	segmentIndex map[string]segmentPosition // positions of the segments by normalized message-id, built by SegmentByID
+	indexFiles   NzbFiles                   // files the segment index was built for
+
+	subjectsMu  sync.Mutex // guards subjects and rawSubjects
+	subjects    []Subject  // parsed subjects of the files by index, built by Subjects
+	rawSubjects []string   // subjects of the files the parsed subjects were parsed from
+}
+
+// returns the locks and caches of the nzb, created on the first call
+// the pointer is accessed atomically instead of with an atomic.Pointer, which vet would report when copying the nzb
+func (n *Nzb) cache() *nzbCache {
+	if c := (*nzbCache)(atomic.LoadPointer(&n.lazy)); c != nil {
+		return c
+	}
+
+	// of concurrent first calls the cache stored first is used by all of them
+	atomic.CompareAndSwapPointer(&n.lazy, nil, unsafe.Pointer(&nzbCache{}))
+
+	return (*nzbCache)(atomic.LoadPointer(&n.lazy))
 }
 
 // a slice of NzbFiles extended to allow sorting
@@ -42,19 +146,190 @@ func (s NzbFiles) Len() int           { return len(s) }
 func (s NzbFiles) Less(i, j int) bool { return s[i].Number < s[j].Number }
 func (s NzbFiles) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
+// sort the files by their filename with the par2 files last, files with equal filenames keep their order
+func (s NzbFiles) SortByFilename() {
+	sort.SliceStable(s, func(i, j int) bool {
+		iPar2, jPar2 := s[i].IsPar2(), s[j].IsPar2()
+		if iPar2 != jPar2 {
+			return jPar2
+		}
+
+		return s[i].Filename < s[j].Filename
+	})
+}
+
+// sort the files by their post date, oldest first, files with equal dates keep their order
+func (s NzbFiles) SortByDate() {
+	sort.SliceStable(s, func(i, j int) bool { return s[i].Date < s[j].Date })
+}
+
+// sort the files by their bytes, smallest first, files with equal bytes keep their order
+func (s NzbFiles) SortBySize() {
+	sort.SliceStable(s, func(i, j int) bool { return s[i].Bytes < s[j].Bytes })
+}
+
 // individual file structure with additional information
 type NzbFile struct {
-	Groups        []string    `xml:"groups>group"`
-	Segments      NzbSegments `xml:"segments>segment"`
-	Poster        string      `xml:"poster,attr"`
-	Date          int         `xml:"date,attr"`
-	Subject       string      `xml:"subject,attr"`
-	Bytes         int64       `xml:"bytes,attr"`    // total size of the file
-	FileHash      string      `xml:"filehash,attr"` // hash of the file
-	Number        int         `xml:"-"`             // number of the file (if indicated in the subject)
-	Filename      string      `xml:"-"`             // filename of the file (if indicated in the subject)
-	Basefilename  string      `xml:"-"`             // basefilename of the file (if indicated in the subject)
-	TotalSegments int         `xml:"-"`             // number of total segments
+	Groups        []string    `xml:"groups>group" json:"groups"`
+	Segments      NzbSegments `xml:"segments>segment" json:"segments"`
+	Poster        string      `xml:"poster,attr" json:"poster"`
+	Date          int         `xml:"date,attr" json:"date"`
+	DateRaw       string      `xml:"-" json:"date_raw,omitempty"` // date attribute as found in the nzb, written back as long as it matches Date
+	Subject       string      `xml:"subject,attr" json:"subject"`
+	Bytes         int64       `xml:"bytes,attr" json:"bytes"`           // total size of the file
+	DeclaredBytes int64       `xml:"-" json:"declared_bytes,omitempty"` // bytes attribute of the file element as found in the nzb (0 if absent)
+	FileHash      string      `xml:"filehash,attr" json:"filehash"`     // hash of the file
+	Number        int         `xml:"-" json:"number"`                   // number of the file in the file set (if indicated in the subject), see PartNumber
+	Filename      string      `xml:"-" json:"filename"`                 // filename of the file (if indicated in the subject)
+	Basefilename  string      `xml:"-" json:"basefilename"`             // basefilename of the file (if indicated in the subject)
+	TotalSegments int         `xml:"-" json:"total_segments"`           // number of total segments
+
+	position int // one based position of the file element in the parsed nzb (0 if unknown)
+
+	Attrs map[string]string `xml:"-" json:"attrs,omitempty"` // further non-standard attributes of the file element, written back in sorted order
+}
+
+// unmarshal the file element, attributes without a field are collected in Attrs
+func (f *NzbFile) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var x struct {
+		xNzbFile
+		Date  string     `xml:"date,attr"` // decoded as string so a malformed date does not fail the parse
+		Attrs []xml.Attr `xml:",any,attr"`
+	}
+
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+
+	*f = NzbFile(x.xNzbFile)
+	f.DeclaredBytes = f.Bytes
+	f.Date = parseDate(x.Date)
+	f.DateRaw = x.Date
+
+	for _, attr := range x.Attrs {
+		if f.Attrs == nil {
+			f.Attrs = make(map[string]string, len(x.Attrs))
+		}
+
+		f.Attrs[attr.Name.Local] = attr.Value
+	}
+
+	return nil
+}
+
+// converts the date attribute to a unix timestamp, missing or malformed dates are 0
+// besides unix seconds the textual dates of dateLayouts and unix milliseconds (beyond 1e12) are accepted
+func parseDate(value string) int {
+	value = strings.TrimSpace(value)
+
+	// parsed as int64, so 13 digit milliseconds don't overflow on 32-bit platforms
+	if date, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// seconds beyond 1e12 are more than 30000 years ahead, so these are milliseconds
+		if date > 1e12 {
+			date /= 1000
+		}
+
+		return int(date)
+	}
+
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return int(date.Unix())
+		}
+	}
+
+	return 0
+}
+
+// marshal the file element including the attributes of Attrs
+// the segments are written sorted by number, the bytes attribute is DeclaredBytes if set and Bytes otherwise
+func (f NzbFile) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return f.marshalXML(e, start, WriteOptions{})
+}
+
+// marshal the file element with its segments written according to the write options
+func (f *NzbFile) marshalXML(e *xml.Encoder, start xml.StartElement, opts WriteOptions) error {
+	// the shadowing attributes come first to keep the order of the attributes, the shadowing segments
+	// are moved behind the groups by the encoder
+	x := struct {
+		Poster string `xml:"poster,attr"`
+		Date   string `xml:"date,attr"`
+		xNzbFile
+		Attrs    []xml.Attr    `xml:",any,attr"`
+		Segments []xNzbSegment `xml:"segments>segment"`
+	}{
+		Poster:   f.Poster,
+		Date:     strconv.Itoa(f.Date),
+		xNzbFile: xNzbFile(*f),
+		Segments: make([]xNzbSegment, 0, len(f.Segments)),
+	}
+
+	for _, segment := range f.Segments {
+		x.Segments = append(x.Segments, xNzbSegment{segment: segment, numberFirst: opts.SegmentNumberFirst})
+	}
+
+	// the copy is sorted, so the segments of the file keep their order
+	switch {
+	case opts.PreserveInputOrder && knownSegmentPositions(f.Segments):
+		sort.SliceStable(x.Segments, func(i, j int) bool {
+			return x.Segments[i].segment.position < x.Segments[j].segment.position
+		})
+	case !opts.KeepSegmentOrder:
+		sort.SliceStable(x.Segments, func(i, j int) bool {
+			return x.Segments[i].segment.Number < x.Segments[j].segment.Number
+		})
+	}
+
+	if opts.NormalizeGroups {
+		x.Groups = normalizeGroups(f.Groups)
+	}
+
+	// keep the original representation unless the date was changed
+	if f.DateRaw != "" && parseDate(f.DateRaw) == f.Date {
+		x.Date = f.DateRaw
+	}
+
+	// the declared size of the parsed nzb is kept instead of the sum of the segments
+	if f.DeclaredBytes != 0 {
+		x.Bytes = f.DeclaredBytes
+	}
+
+	for _, name := range sortedKeys(f.Attrs) {
+		x.Attrs = append(x.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: f.Attrs[name]})
+	}
+
+	return e.EncodeElement(x, start)
+}
+
+// marshal the segment element including the attributes of Attrs, the bytes attribute is left out if the size is unknown (0)
+func (s NzbSegment) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return s.marshalXML(e, start, false)
+}
+
+// marshal the segment element with the number attribute first if numberFirst is set
+// the message-id is written as escaped character data, the decoder reads it as inner xml and unescapes it
+func (s *NzbSegment) marshalXML(e *xml.Encoder, start xml.StartElement, numberFirst bool) error {
+	number := xml.Attr{Name: xml.Name{Local: "number"}, Value: strconv.Itoa(s.Number)}
+
+	if numberFirst {
+		start.Attr = append(start.Attr, number)
+	}
+
+	if s.Bytes != 0 {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "bytes"}, Value: strconv.FormatInt(s.Bytes, 10)})
+	}
+
+	if !numberFirst {
+		start.Attr = append(start.Attr, number)
+	}
+
+	for _, name := range sortedKeys(s.Attrs) {
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: name}, Value: s.Attrs[name]})
+	}
+
+	return e.EncodeElement(struct {
+		ID string `xml:",chardata"`
+	}{s.ID}, start)
 }
 
 // a slice of NzbSegments extended to allow sorting
@@ -66,9 +341,48 @@ func (s NzbSegments) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
 // individual segment structure
 type NzbSegment struct {
-	Bytes  int    `xml:"bytes,attr"`
-	Number int    `xml:"number,attr"`
-	ID     string `xml:",innerxml"`
+	Bytes    int64  `xml:"bytes,attr" json:"bytes"`
+	Number   int    `xml:"number,attr" json:"number"`
+	ID       string `xml:",innerxml" json:"id"`
+	position int    // one based position of the segment element within the parsed file (0 if unknown)
+
+	Attrs map[string]string `xml:"-" json:"attrs,omitempty"` // further non-standard attributes of the segment element, written back in sorted order
+}
+
+// unmarshal the segment element, attributes without a field are collected in Attrs
+func (s *NzbSegment) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	// segment type without methods for unmarshalling the fields with their xml tags
+	type plainSegment NzbSegment
+
+	var x struct {
+		plainSegment
+		Attrs []xml.Attr `xml:",any,attr"`
+	}
+
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+
+	*s = NzbSegment(x.plainSegment)
+
+	for _, attr := range x.Attrs {
+		if s.Attrs == nil {
+			s.Attrs = make(map[string]string, len(x.Attrs))
+		}
+
+		s.Attrs[attr.Name.Local] = attr.Value
+	}
+
+	return nil
+}
+
+// textual date formats of the file date attribute written by some tools instead of unix seconds
+var dateLayouts = []string{
+	"Mon, 2 Jan 2006 15:04:05 -0700", // RFC1123Z with single digit days
+	"Mon, 2 Jan 2006 15:04:05 MST",   // RFC1123 with single digit days
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339,
 }
 
 // parse nzb file provided as string
@@ -81,52 +395,516 @@ func ParseStringWithOptions(data string, opts ParseOptions) (*Nzb, error) {
 	return ParseWithOptions(bytes.NewBufferString(data), opts)
 }
 
+// parse nzb file provided as byte slice without copying it
+func ParseBytes(data []byte) (*Nzb, error) {
+	return Parse(bytes.NewReader(data))
+}
+
+// parse nzb file provided as byte slice with custom options without copying it
+func ParseBytesWithOptions(data []byte, opts ParseOptions) (*Nzb, error) {
+	return ParseWithOptions(bytes.NewReader(data), opts)
+}
+
 // parse nzb file provided as io.Reader buffer
 func Parse(buf io.Reader) (*Nzb, error) {
-	return ParseWithOptions(buf, ParseOptions{RemoveDuplicates: true})
+	return ParseContext(context.Background(), buf)
 }
 
 // parse nzb file provided as io.Reader buffer with custom options
 func ParseWithOptions(buf io.Reader, opts ParseOptions) (*Nzb, error) {
-	// parse nzb file into temp structure
-	xnzb := new(xNzb)
-	decoder := xml.NewDecoder(buf)
-	decoder.CharsetReader = charset.NewReaderLabel
-	decoder.Strict = false // ignore unknown or malformed character entities
+	nzb, _, err := parse(context.Background(), buf, opts)
+	return nzb, err
+}
+
+// parse nzb file provided as io.Reader buffer with custom options and report recoverable problems as warnings
+// the warnings name files skipped with SkipMalformedFiles, segments dropped with ValidateMessageIDs, files without
+// segments, subjects without filename, segments without bytes and incomplete segment lists
+func ParseVerbose(buf io.Reader, opts ParseOptions) (*Nzb, []string, error) {
+	nzb, skipped, err := parse(context.Background(), buf, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nzb, append(skipped, nzb.warnings()...), nil
+}
+
+// parse nzb file provided as io.Reader buffer and stop with ctx.Err() as soon as the context is done
+func ParseContext(ctx context.Context, buf io.Reader) (*Nzb, error) {
+	nzb, _, err := parse(ctx, buf, ParseOptions{RemoveDuplicates: true})
+	return nzb, err
+}
+
+// parse nzb file from the given path, gzip compressed files (.gz) are decompressed transparently
+func ParseFile(path string) (*Nzb, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open NZB file %s: %w", path, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var buf io.Reader = bufio.NewReader(file)
+
+	if strings.HasSuffix(strings.ToLower(path), ".gz") {
+		gz, err := gzip.NewReader(buf)
+		if err != nil {
+			return nil, fmt.Errorf("unable to decompress NZB file %s: %w", path, err)
+		}
+		defer func() { _ = gz.Close() }()
+
+		buf = gz
+	}
+
+	nzb, err := Parse(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return nzb, nil
+}
+
+// parse the nzb files (.nzb) of the zip archive in the order of the archive, other entries are skipped
+// entries which fail to open or parse are left out and their errors are returned joined with the parsed nzbs
+func ParseZip(r io.ReaderAt, size int64) ([]*Nzb, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open zip archive: %w", err)
+	}
+
+	var nzbs []*Nzb
+	var errs []error
+
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() || !strings.HasSuffix(strings.ToLower(entry.Name), ".nzb") {
+			continue
+		}
+
+		nzb, err := parseZipEntry(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Name, err))
+			continue
+		}
+
+		nzbs = append(nzbs, nzb)
+	}
 
-	if err := decoder.Decode(xnzb); err != nil {
-		return nil, fmt.Errorf("unable to parse NZB file: %s", err.Error())
+	return nzbs, errors.Join(errs...)
+}
+
+// parse the nzb file of the zip archive entry
+func parseZipEntry(entry *zip.File) (*Nzb, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, err
 	}
+	defer func() { _ = rc.Close() }()
 
-	// convert to nicer format
+	return Parse(rc)
+}
+
+// parse nzb file provided as io.Reader buffer, checking the context between the decoded files
+func parse(ctx context.Context, buf io.Reader, opts ParseOptions) (*Nzb, []string, error) {
+	if !opts.DisableGzip {
+		var err error
+		if buf, err = sniffGzip(buf); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if opts.MaxBytes > 0 {
+		buf = &limitedReader{r: buf, max: opts.MaxBytes, remaining: opts.MaxBytes}
+	}
+
+	// decode the nzb file and collect its files
 	nzb := new(Nzb)
+	position := 0
+
+	var warnings []string // warnings about the dropped segments
+
+	xnzb, err := decodeNzb(buf, opts, func(file NzbFile) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if opts.MaxFiles > 0 && len(nzb.Files) >= opts.MaxFiles {
+			return fmt.Errorf("%w: more than %d files", ErrTooLarge, opts.MaxFiles)
+		}
+
+		if opts.MaxSegmentsPerFile > 0 && len(file.Segments) > opts.MaxSegmentsPerFile {
+			return fmt.Errorf("%w: more than %d segments in file %q", ErrTooLarge, opts.MaxSegmentsPerFile, file.Subject)
+		}
+
+		// remember the order of the input for WriteOptions.PreserveInputOrder
+		position++
+		file.position = position
+
+		for id := range file.Segments {
+			file.Segments[id].position = id + 1
+		}
+
+		// clean the message-ids before the duplicates are searched
+		cleanSegmentIDs(&file, !opts.KeepRawMessageIDs)
+
+		if opts.ValidateMessageIDs {
+			valid := file.Segments[:0]
+
+			for _, segment := range file.Segments {
+				if IsValidMessageID(segment.ID) {
+					valid = append(valid, segment)
+				} else {
+					warnings = append(warnings, fmt.Sprintf("file %q: segment %d: invalid message-id %q dropped", file.Subject, segment.Number, segment.ID))
+				}
+			}
+
+			file.Segments = valid
+		}
+
+		nzb.Files = append(nzb.Files, file)
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// don't post-process a partially built nzb
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(nzb.Files) == 0 {
+		return nil, nil, ErrEmptyNZB
+	}
 
 	// copy elements
-	nzb.Comment = xnzb.Comment
-	nzb.Files = xnzb.Files
+	// the padding added by Write is not part of the comment
+	nzb.Comment = strings.TrimSpace(xnzb.Comment)
+	nzb.Namespace = xnzb.Xmlns
+
+	for _, comment := range xnzb.headComments {
+		nzb.HeadComments = append(nzb.HeadComments, strings.TrimSpace(comment))
+	}
 
 	// convert metadata
 	nzb.Meta = make(map[string]string)
+	nzb.MetaMulti = make(map[string][]string)
+
 	for _, md := range xnzb.Metadata {
-		nzb.Meta[md.Type] = md.Value
+		if _, ok := nzb.Meta[md.Type]; !ok {
+			nzb.Meta[md.Type] = md.Value
+		}
+
+		nzb.MetaMulti[md.Type] = append(nzb.MetaMulti[md.Type], md.Value)
 	}
 
 	// conditionally remove duplicate entries
 	if opts.RemoveDuplicates {
-		MakeUnique(nzb)
+		// the filenames are only known after scanning
+		if opts.DedupKey == DedupByFilename {
+			scanNzbFiles(nzb, opts)
+		}
+
+		makeUnique(nzb, opts)
+	}
+
+	// conditionally remove duplicate segments across files
+	if opts.GlobalDedup {
+		removeDuplicateSegmentIDs(nzb, opts.CaseFoldSegmentIDs)
 	}
 
 	// scan the nzb for the additional information
-	ScanNzbFile(nzb)
+	scanNzbFiles(nzb, opts)
+
+	if opts.RejectZeroBytes && !nzb.HasPayload() {
+		return nil, nil, ErrNoPayload
+	}
+
+	nzb.Password = findPassword(nzb)
 
 	// sort the files and segments
-	sort.Sort(nzb.Files)
+	if !opts.NoSort {
+		sortNzb(nzb, opts.SortBy)
+	}
+
+	// the policy of the caller is checked on the nzb as it would be returned
+	if opts.Validator != nil {
+		if err := opts.Validator(nzb); err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrRejected, err)
+		}
+	}
+
+	return nzb, append(xnzb.skipped, warnings...), nil
+}
+
+// sort the files and their segments of the nzb in the given order, files and segments with equal keys keep their order
+func sortNzb(nzb *Nzb, by SortBy) {
+	switch by {
+	case SortByNone:
+		return
+	case SortByFilename:
+		nzb.Files.SortByFilename()
+	default:
+		sort.Stable(nzb.Files)
+	}
 
 	for id := range nzb.Files {
-		sort.Sort(nzb.Files[id].Segments)
+		sort.Stable(nzb.Files[id].Segments)
 	}
+}
 
-	return nzb, nil
+// check the first bytes of the input for the gzip magic and wrap it in a gzip reader if present
+// the peeked bytes stay in the returned reader, so uncompressed input is read unchanged
+func sniffGzip(buf io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(buf)
+
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return br, nil
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidNZB, err.Error())
+	}
+
+	return gz, nil
+}
+
+// create a lenient xml decoder for nzb files
+// with forceCharset the input is decoded from the named charset regardless of the xml declaration
+func newDecoder(buf io.Reader, forceCharset string) (*xml.Decoder, error) {
+	charsetReader := charset.NewReaderLabel
+
+	if forceCharset != "" {
+		forced, err := charset.NewReaderLabel(forceCharset, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		buf = forced
+
+		// the input is already converted, so don't convert it again for the declared charset
+		charsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+			return input, nil
+		}
+	}
+
+	decoder := xml.NewDecoder(buf)
+	decoder.CharsetReader = charsetReader
+	decoder.Strict = false // ignore unknown or malformed character entities
+
+	return decoder, nil
+}
+
+// decode the nzb root element token by token, handing every <file> element to fn as soon as it is decoded
+// the returned temp structure holds the comment and metadata but no files
+// decoding errors are wrapped in ErrInvalidNZB while errors of the reader and errors returned by fn
+// stop the decoding and are passed through as they are, opts.ForceCharset is used as with newDecoder
+// with opts.SkipMalformedFiles files failing to unmarshal are left out and noted as warnings in the temp structure
+func decodeNzb(buf io.Reader, opts ParseOptions, fn func(NzbFile) error) (*xNzb, error) {
+	reader := &errorTrackingReader{r: buf}
+
+	decoder, err := newDecoder(reader, opts.ForceCharset)
+	if err != nil {
+		return nil, err
+	}
+
+	invalid := func(err error) error {
+		if reader.err != nil && errors.Is(err, reader.err) {
+			return err
+		}
+
+		return fmt.Errorf("%w: %s", ErrInvalidNZB, err.Error())
+	}
+
+	xnzb := new(xNzb)
+
+	// search for the root element
+	var root *xml.StartElement
+
+	for root == nil {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, invalid(err)
+		}
+
+		if se, ok := token.(xml.StartElement); ok {
+			if se.Name.Local != "nzb" {
+				return nil, invalid(fmt.Errorf("expected element type <nzb> but have <%s>", se.Name.Local))
+			}
+
+			root = &se
+			xnzb.Xmlns = se.Name.Space
+		}
+	}
+
+	// decode the children of the root element
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, invalid(err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "head":
+				head := new(xNzbHead)
+				if err := decoder.DecodeElement(head, &t); err != nil {
+					return nil, invalid(err)
+				}
+
+				xnzb.Metadata = append(xnzb.Metadata, head.Metadata...)
+				xnzb.headComments = append(xnzb.headComments, head.Comments...)
+			case "file":
+				var file NzbFile
+
+				if opts.SkipMalformedFiles {
+					// read the whole element first, so a file failing to unmarshal can be skipped
+					tokens, err := elementTokens(decoder)
+					if err != nil {
+						return nil, invalid(err)
+					}
+
+					if file, err = decodeFileTokens(append([]xml.Token{t.Copy()}, tokens...)); err != nil {
+						xnzb.skipped = append(xnzb.skipped, fmt.Sprintf("file %q: skipped: %v", attrValue(t.Attr, "subject"), err))
+						continue
+					}
+				} else if err := decoder.DecodeElement(&file, &t); err != nil {
+					return nil, invalid(err)
+				}
+
+				if err := fn(file); err != nil {
+					return nil, err
+				}
+			default:
+				if err := decoder.Skip(); err != nil {
+					return nil, invalid(err)
+				}
+			}
+		case xml.Comment:
+			xnzb.Comment = xnzb.Comment + string(t)
+		case xml.EndElement:
+			// end of the root element
+			return xnzb, nil
+		}
+	}
+}
+
+// returns copies of the tokens of the current element up to and including its end element
+func elementTokens(decoder *xml.Decoder) ([]xml.Token, error) {
+	var tokens []xml.Token
+
+	for depth := 1; depth > 0; {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch token.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+
+		tokens = append(tokens, xml.CopyToken(token))
+	}
+
+	return tokens, nil
+}
+
+// decodes the file from the tokens of its element
+// the tokens are encoded again, so the segment ids are read as inner xml like with the regular decoder
+func decodeFileTokens(tokens []xml.Token) (NzbFile, error) {
+	var (
+		file NzbFile
+		buf  bytes.Buffer
+	)
+
+	encoder := xml.NewEncoder(&buf)
+	for _, token := range tokens {
+		// drop the namespace of the nzb, otherwise the encoder declares it as attribute of the file
+		switch t := token.(type) {
+		case xml.StartElement:
+			t.Name.Space = ""
+			token = t
+		case xml.EndElement:
+			t.Name.Space = ""
+			token = t
+		}
+
+		if err := encoder.EncodeToken(token); err != nil {
+			return file, err
+		}
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return file, err
+	}
+
+	decoder := xml.NewDecoder(&buf)
+	decoder.Strict = false
+
+	err := decoder.Decode(&file)
+
+	return file, err
+}
+
+// returns the value of the attribute with the given local name or an empty string
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, attr := range attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+// io.Reader wrapper failing with ErrTooLarge as soon as more than max bytes are read
+type limitedReader struct {
+	r         io.Reader
+	max       int64
+	remaining int64
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	// read one byte more than allowed to detect oversized input, compared without overflowing for a limit of MaxInt64
+	if lr.remaining < int64(len(p))-1 {
+		p = p[:lr.remaining+1]
+	}
+
+	n, err := lr.r.Read(p)
+	if int64(n) > lr.remaining {
+		n = int(lr.remaining)
+		lr.remaining = 0
+
+		return n, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, lr.max)
+	}
+
+	lr.remaining = lr.remaining - int64(n)
+
+	return n, err
+}
+
+// io.Reader wrapper remembering the last error of the underlying reader (except io.EOF)
+// to tell i/o errors apart from decoding errors
+type errorTrackingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (er *errorTrackingReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+	if err != nil && err != io.EOF {
+		er.err = err
+	}
+
+	return n, err
 }
 
 // write nzb struct to nzb xml as string
@@ -137,6 +915,34 @@ func WriteString(nzb *Nzb) (string, error) {
 
 // write nzb struct to nzb xml as byte slice
 func Write(nzb *Nzb) ([]byte, error) {
+	return WriteWithOptions(nzb, WriteOptions{})
+}
+
+// write nzb struct to nzb xml as byte slice with custom options
+func WriteWithOptions(nzb *Nzb, opts WriteOptions) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if _, err := WriteToWithOptions(&buf, nzb, opts); err != nil {
+		return []byte(""), err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// write nzb struct as nzb xml to the io.Writer and return the number of bytes written
+func WriteTo(w io.Writer, nzb *Nzb) (int64, error) {
+	return WriteToWithOptions(w, nzb, WriteOptions{})
+}
+
+// write nzb struct as nzb xml to the io.Writer with custom options and return the number of bytes written
+// nothing is written if the validation is enabled and fails
+func WriteToWithOptions(w io.Writer, nzb *Nzb, opts WriteOptions) (int64, error) {
+	if opts.Validate {
+		if err := nzb.Validate(); err != nil {
+			return 0, err
+		}
+	}
+
 	// create temp structure
 	xnzb := new(xNzb)
 
@@ -146,69 +952,208 @@ func Write(nzb *Nzb) ([]byte, error) {
 	}
 
 	xnzb.Files = nzb.Files
+	xnzb.writeOpts = opts
 
 	// add namespace
 	xnzb.Xmlns = Xmlns
+	if nzb.Namespace != "" {
+		xnzb.Xmlns = nzb.Namespace
+	}
+
+	// write header and stream the marshalled xml
+	cw := &countingWriter{w: w}
+
+	// add head comments and metadata
+	xnzb.Metadata = metaElements(nzb)
+	xnzb.HeadComments = headComments(cw, nzb.HeadComments, xnzb.Metadata, opts)
+
+	if opts.Header != "" {
+		if _, err := io.WriteString(cw, opts.Header); err != nil {
+			return cw.n, err
+		}
+	} else {
+		if !opts.OmitXMLDeclaration {
+			if _, err := io.WriteString(cw, xmlDeclaration); err != nil {
+				return cw.n, err
+			}
+		}
 
-	// add metadata
-	for t, v := range nzb.Meta {
-		xnzb.Metadata = append(xnzb.Metadata, xNzbMeta{Type: t, Value: v})
+		if !opts.OmitHeader {
+			if _, err := io.WriteString(cw, doctype); err != nil {
+				return cw.n, err
+			}
+		}
 	}
 
-	// Marshal and prepend header
-	file, err := xml.MarshalIndent(xnzb, "", "  ")
-	if err != nil {
-		return []byte(""), err
+	encoder := xml.NewEncoder(cw)
+
+	if !opts.Compact {
+		indent := opts.Indent
+		if indent == "" {
+			indent = "  "
+		}
+
+		encoder.Indent("", indent)
+	}
+
+	if err := encoder.Encode(xnzb); err != nil {
+		return cw.n, err
+	}
+
+	return cw.n, nil
+}
+
+// collect the meta data elements to write, one element per value
+// Meta decides which types are written and holds their first value, MetaMulti adds the further values
+// of a type, MetaMulti alone is only used if Meta is nil
+// the types are written in sorted order so the output is the same for the same input, the values of a type
+// keep their order because the first one is the value of Meta when the nzb is parsed again
+func metaElements(nzb *Nzb) []xNzbMeta {
+	var elements []xNzbMeta
+
+	if nzb.Meta == nil {
+		for _, t := range sortedKeys(nzb.MetaMulti) {
+			for _, v := range nzb.MetaMulti[t] {
+				elements = append(elements, xNzbMeta{Type: t, Value: v})
+			}
+		}
+
+		return elements
+	}
+
+	for _, t := range sortedKeys(nzb.Meta) {
+		elements = append(elements, xNzbMeta{Type: t, Value: nzb.Meta[t]})
+
+		if values := nzb.MetaMulti[t]; len(values) > 1 {
+			for _, value := range values[1:] {
+				elements = append(elements, xNzbMeta{Type: t, Value: value})
+			}
+		}
 	}
 
-	return append([]byte(Header), file...), nil
+	return elements
+}
+
+// returns the head comments written to w padded like the nzb comment and indented like the meta data elements
+func headComments(w io.Writer, comments []string, metadata []xNzbMeta, opts WriteOptions) []xNzbComment {
+	var indent string
+
+	if !opts.Compact {
+		indent = opts.Indent
+		if indent == "" {
+			indent = "  "
+		}
+	}
+
+	var xcomments []xNzbComment
+
+	for _, comment := range comments {
+		xcomment := xNzbComment{text: " " + comment + " ", w: w}
+		if indent != "" {
+			xcomment.before = "\n" + indent + indent
+		}
+
+		xcomments = append(xcomments, xcomment)
+	}
+
+	// the closing head element follows the last comment if there is no meta data
+	if len(xcomments) > 0 && len(metadata) == 0 && indent != "" {
+		xcomments[len(xcomments)-1].after = "\n" + indent
+	}
+
+	return xcomments
+}
+
+// returns the keys of the map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// io.Writer wrapper counting the bytes written
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n = cw.n + int64(n)
+
+	return n, err
 }
 
 // scan the nzb struct for additional information
 func ScanNzbFile(nzb *Nzb) {
-	var segments int // total amount of available segments
+	for id := range nzb.Files {
+		cleanSegmentIDs(&nzb.Files[id], true)
+	}
 
-	var totalSegments int // theoretical total amount of segments based on the subject count
+	scanNzb(nzb)
+}
 
-	var totalBytes int64 // total size of all available segments
+// scan the nzb struct for additional information without touching the segment message-ids
+func scanNzb(nzb *Nzb) {
+	scanNzbFiles(nzb, ParseOptions{})
+}
 
-	var totalFiles int // theoretical total amount of files based on the subject count
+// scan the nzb struct for additional information without touching the segment message-ids
+// with Parallel the files are scanned by a pool of GOMAXPROCS workers, the results are the same as scanned sequentially
+// the further scan options of the parse options are applied to every file (see scanFile)
+func scanNzbFiles(nzb *Nzb, opts ParseOptions) {
+	// theoretical total amount of files of each file based on its subject count
+	subjectFiles := make([]int, len(nzb.Files))
 
-	for id, file := range nzb.Files {
-		var totalFileSegments int // theoretical total amount of segments of this file based on the subject count
+	if opts.Parallel && len(nzb.Files) > 1 {
+		workers := min(runtime.GOMAXPROCS(0), len(nzb.Files))
 
-		var totalFileBytes int64 // total size of all available segments of this file
+		var wg sync.WaitGroup
 
-		if subject, err := ParseSubject(file.Subject); err == nil {
-			nzb.Files[id].Number = subject.File
+		for worker := 0; worker < workers; worker++ {
+			wg.Add(1)
 
-			if subject.Filename != "" {
-				nzb.Files[id].Filename = subject.Filename
-			} else {
-				nzb.Files[id].Filename = subject.Header
-			}
+			go func(worker int) {
+				defer wg.Done()
 
-			totalFileSegments = subject.TotalSegments
+				// every worker scans its own distinct files
+				for id := worker; id < len(nzb.Files); id = id + workers {
+					subjectFiles[id] = scanFile(&nzb.Files[id], opts)
+				}
+			}(worker)
+		}
 
-			if subject.TotalFiles > totalFiles {
-				totalFiles = subject.TotalFiles
-			}
+		wg.Wait()
+	} else {
+		for id := range nzb.Files {
+			subjectFiles[id] = scanFile(&nzb.Files[id], opts)
 		}
+	}
 
-		for i, segment := range file.Segments {
-			if segment.Number > totalFileSegments {
-				totalFileSegments = segment.Number
-			}
+	var segments int // total amount of available segments
+
+	var totalSegments int // theoretical total amount of segments based on the subject count
+
+	var totalBytes int64 // total size of all available segments
+
+	var estimatedBytes int64 // estimated size of all segments including the missing ones
+
+	var totalFiles int // theoretical total amount of files based on the subject count
 
-			totalBytes = totalBytes + int64(segment.Bytes)
-			totalFileBytes = totalFileBytes + int64(segment.Bytes)
-			nzb.Files[id].Segments[i].ID = html.UnescapeString(segment.ID)
+	for id := range nzb.Files {
+		if subjectFiles[id] > totalFiles {
+			totalFiles = subjectFiles[id]
 		}
 
-		segments = segments + file.Segments.Len()
-		totalSegments = totalSegments + totalFileSegments
-		nzb.Files[id].TotalSegments = totalFileSegments
-		nzb.Files[id].Bytes = totalFileBytes
+		segments = segments + nzb.Files[id].Segments.Len()
+		totalSegments = totalSegments + nzb.Files[id].TotalSegments
+		totalBytes = totalBytes + nzb.Files[id].Bytes
+		estimatedBytes = estimatedBytes + estimatedTotalBytes(&nzb.Files[id])
 	}
 
 	if totalFiles < nzb.Files.Len() {
@@ -220,21 +1165,125 @@ func ScanNzbFile(nzb *Nzb) {
 	nzb.Segments = segments
 	nzb.TotalSegments = totalSegments
 	nzb.Bytes = totalBytes
+	nzb.TotalBytes = estimatedBytes
+}
+
+// scan a single file for additional information
+// returns the theoretical total amount of files of the file set based on the subject count
+// the subject is looked up in the SubjectCache of the options, with TrustSubjectSegmentTotal the segment total of the
+// subject is taken as it is
+func scanFile(file *NzbFile, opts ParseOptions) int {
+	var totalFiles int // theoretical total amount of files based on the subject count
+
+	var totalFileSegments int // theoretical total amount of segments of this file based on the subject count
+
+	var totalFileBytes int64 // total size of all available segments of this file
+
+	if subject, err := opts.SubjectCache.parse(file.Subject); err == nil {
+		file.Number = subject.File
+
+		if subject.Filename != "" {
+			file.Filename = subject.Filename
+			file.Basefilename = subject.Basefilename
+		} else {
+			file.Filename = subject.Header
+			file.Basefilename = subject.Header
+		}
+
+		totalFileSegments = subject.TotalSegments
+		totalFiles = subject.TotalFiles
+	}
+
+	// the nzb is authoritative about the segment total, subjects stating no or too few segments (e.g. "(1/0)")
+	// fall back to the highest segment number present unless the subject total is trusted
+	trustSubject := opts.TrustSubjectSegmentTotal && totalFileSegments > 0
+
+	for _, segment := range file.Segments {
+		if segment.Number > totalFileSegments && !trustSubject {
+			totalFileSegments = segment.Number
+		}
+
+		totalFileBytes = totalFileBytes + segment.Bytes
+	}
+
+	file.TotalSegments = totalFileSegments
+	file.Bytes = totalFileBytes
+
+	return totalFiles
+}
+
+// unescape the message-ids of the file segments, remove their whitespace and optionally their angle brackets
+func cleanSegmentIDs(file *NzbFile, stripBrackets bool) {
+	for i := range file.Segments {
+		file.Segments[i].ID = cleanSegmentID(file.Segments[i].ID, stripBrackets)
+	}
+}
+
+// unescape a segment message-id and remove any whitespace (message-ids spanning several lines in pretty-printed nzbs)
+// with stripBrackets a single pair of enclosing angle brackets is removed as well (<id@host> becomes id@host)
+// the content of an enclosing CDATA section is taken as it is without unescaping
+func cleanSegmentID(id string, stripBrackets bool) string {
+	if trimmed := strings.TrimSpace(id); strings.HasPrefix(trimmed, "<![CDATA[") && strings.HasSuffix(trimmed, "]]>") {
+		id = trimmed[len("<![CDATA[") : len(trimmed)-len("]]>")]
+	} else {
+		id = html.UnescapeString(id)
+	}
+
+	if stripBrackets {
+		return normalizeSegmentID(id)
+	}
+
+	return removeSpaces(id)
+}
+
+// normalize an unescaped segment message-id by removing any whitespace and a single pair of enclosing angle brackets
+func normalizeSegmentID(id string) string {
+	id = removeSpaces(id)
+
+	if len(id) > 1 && strings.HasPrefix(id, "<") && strings.HasSuffix(id, ">") {
+		id = id[1 : len(id)-1]
+	}
+
+	return id
+}
+
+// remove any whitespace of the message-id
+func removeSpaces(id string) string {
+	if strings.ContainsFunc(id, unicode.IsSpace) {
+		return strings.Join(strings.Fields(id), "")
+	}
+
+	return id
 }
 
 // clean up nzb files by keeping only the first occurrence of duplicate file entries and removing duplicate segments
 func MakeUnique(nzb *Nzb) {
+	makeUnique(nzb, ParseOptions{})
+}
+
+// clean up nzb files by keeping only the first occurrence of duplicate file entries and removing duplicate segments
+// the duplicate file entries are identified by the key selected with DedupKey
+// with MergeDuplicateFiles the segments of duplicate file entries are added to the first occurrence
+// with PreferLargerSegments a duplicate segment replaces the kept one if it has more bytes, keeping its position
+// with CaseFoldSegmentIDs segments whose message-ids differ only in case are duplicates
+func makeUnique(nzb *Nzb, opts ParseOptions) {
 	// check for duplicate file entries and keep only the first occurrence
 	var uniqueFiles []NzbFile
 
 	fileKeys := make(map[string]int) // helper map for unique keys
 	for _, file := range nzb.Files {
-		if _, ok := fileKeys[file.Subject]; ok {
-			// file already found, skip it (discard duplicate and its segments)
+		key := dedupKey(&file, opts.DedupKey)
+		if i, ok := fileKeys[key]; ok {
+			if opts.MergeDuplicateFiles {
+				// file already found, add its segments to the first occurrence (without touching the original slice)
+				segments := uniqueFiles[i].Segments
+				uniqueFiles[i].Segments = append(segments[:len(segments):len(segments)], file.Segments...)
+			}
+			// otherwise skip it (discard duplicate and its segments)
 			continue
 		}
 		// Unique file found. Record position and collect in result.
-		fileKeys[file.Subject] = len(uniqueFiles)
+		fileKeys[key] = len(uniqueFiles)
 		uniqueFiles = append(uniqueFiles, file)
 	}
 
@@ -246,10 +1295,14 @@ func MakeUnique(nzb *Nzb) {
 
 		segmentKeys := make(map[string]int) // helper map for unique keys
 		for _, segment := range file.Segments {
-			if _, ok := segmentKeys[segment.ID]; !ok {
+			key := segmentKey(segment.ID, opts.CaseFoldSegmentIDs)
+			if j, ok := segmentKeys[key]; !ok {
 				// Unique key found. Record position and collect in result.
-				segmentKeys[segment.ID] = len(uniqueSegments)
+				segmentKeys[key] = len(uniqueSegments)
 				uniqueSegments = append(uniqueSegments, segment)
+			} else if opts.PreferLargerSegments && segment.Bytes > uniqueSegments[j].Bytes {
+				// a later copy with a corrected size
+				uniqueSegments[j] = segment
 			}
 		}
 
@@ -257,17 +1310,189 @@ func MakeUnique(nzb *Nzb) {
 	}
 }
 
+// returns the key identifying duplicates of the file, filenames have to be scanned for DedupByFilename
+func dedupKey(file *NzbFile, by DedupKey) string {
+	switch by {
+	case DedupByFilename:
+		if file.Filename != "" {
+			return file.Filename
+		}
+	case DedupBySegmentSet:
+		if len(file.Segments) > 0 {
+			ids := make([]string, 0, len(file.Segments))
+			for _, segment := range file.Segments {
+				ids = append(ids, segment.ID)
+			}
+
+			sort.Strings(ids)
+
+			return strings.Join(slices.Compact(ids), "\x00")
+		}
+	}
+
+	return file.Subject
+}
+
 // temp nzb file struct for (un)marshalling
 type xNzb struct {
-	Comment  string     `xml:",comment"`
-	XMLName  xml.Name   `xml:"nzb"`
-	Xmlns    string     `xml:"xmlns,attr"`
-	Metadata []xNzbMeta `xml:"head>meta"`
-	Files    NzbFiles   `xml:"file"`
+	Comment      string        `xml:",comment"`
+	XMLName      xml.Name      `xml:"nzb"`
+	Xmlns        string        `xml:"xmlns,attr"`
+	HeadComments []xNzbComment `xml:"head>comment"`
+	Metadata     []xNzbMeta    `xml:"head>meta"`
+	Files        NzbFiles      `xml:"file"`
+
+	headComments []string     // comments within the head collected by decodeNzb
+	skipped      []string     // warnings about the files skipped by decodeNzb with SkipMalformedFiles
+	writeOpts    WriteOptions // options of the files written by MarshalXML
+}
+
+// marshal the nzb with its files written according to the write options
+func (x xNzb) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	// the files shadow the files of the nzb type without methods
+	type plainNzb xNzb
+
+	nzb := struct {
+		plainNzb
+		Files []xNzbWriteFile `xml:"file"`
+	}{
+		plainNzb: plainNzb(x),
+		Files:    make([]xNzbWriteFile, 0, len(x.Files)),
+	}
+
+	for id := range x.Files {
+		nzb.Files = append(nzb.Files, xNzbWriteFile{file: &x.Files[id], opts: &x.writeOpts})
+	}
+
+	switch {
+	case x.writeOpts.PreserveInputOrder && knownFilePositions(x.Files):
+		sort.SliceStable(nzb.Files, func(i, j int) bool {
+			return nzb.Files[i].file.position < nzb.Files[j].file.position
+		})
+	case x.writeOpts.SortFiles:
+		sort.SliceStable(nzb.Files, func(i, j int) bool {
+			return nzb.Files[i].file.Number < nzb.Files[j].file.Number
+		})
+	}
+
+	// the encoder names the element after the type for marshalers
+	start.Name = xml.Name{Local: "nzb"}
+
+	return e.EncodeElement(nzb, start)
+}
+
+// returns true if the files have their positions of the parsed nzb
+func knownFilePositions(files NzbFiles) bool {
+	for id := range files {
+		if files[id].position <= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// returns true if the segments have their positions of the parsed file
+func knownSegmentPositions(segments NzbSegments) bool {
+	for _, segment := range segments {
+		if segment.position <= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// temp file for marshalling with the write options
+type xNzbWriteFile struct {
+	file *NzbFile
+	opts *WriteOptions
+}
+
+// marshal the file according to the write options
+func (f xNzbWriteFile) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return f.file.marshalXML(e, start, *f.opts)
+}
+
+// temp segment for marshalling with the order of its attributes
+type xNzbSegment struct {
+	segment     NzbSegment
+	numberFirst bool
+}
+
+// marshal the segment with the number attribute first if numberFirst is set
+func (s xNzbSegment) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return s.segment.marshalXML(e, start, s.numberFirst)
+}
+
+// nzb file type without methods for (un)marshalling the fields with their xml tags
+type xNzbFile NzbFile
+
+// temp nzb head struct for unmarshalling
+type xNzbHead struct {
+	Comments []string
+	Metadata []xNzbMeta
+}
+
+// unmarshal the head element, its comments are collected in order unlike with a ",comment" field
+func (h *xNzbHead) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "meta" {
+				if err := d.Skip(); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			var meta xNzbMeta
+			if err := d.DecodeElement(&meta, &t); err != nil {
+				return err
+			}
+
+			h.Metadata = append(h.Metadata, meta)
+		case xml.Comment:
+			h.Comments = append(h.Comments, string(t))
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// temp comment within the head, written as xml comment instead of an element
+// the encoder neither indents nor writes raw whitespace around comment tokens, so the comment is written directly to w
+type xNzbComment struct {
+	text   string
+	before string    // whitespace written before the comment
+	after  string    // whitespace written after the comment
+	w      io.Writer // writer of the encoder
+}
+
+// marshal the comment as xml comment ignoring the element name
+func (c xNzbComment) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	if strings.Contains(c.text, "--") {
+		return errors.New(`xml: comments must not contain "--"`)
+	}
+
+	// everything encoded so far has to be written first
+	if err := e.Flush(); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(c.w, c.before+"<!--"+c.text+"-->"+c.after)
+
+	return err
 }
 
-// temp raw meta data for (un)marshalling
+// temp meta data for (un)marshalling, the value is escaped and unescaped as character data
 type xNzbMeta struct {
 	Type  string `xml:"type,attr"`
-	Value string `xml:",innerxml"`
+	Value string `xml:",chardata"`
 }
@@ -1,12 +1,22 @@
 package nzbparser
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseString(t *testing.T) {
@@ -95,6 +105,42 @@ func TestParseString(t *testing.T) {
 	}
 }
 
+func TestParseBytes(t *testing.T) {
+	expected, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	nzb, err := ParseBytes([]byte(streamTestNZB))
+	if err != nil {
+		t.Fatalf("ParseBytes failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(nzb, expected) {
+		t.Errorf("Expected ParseBytes to return the same as ParseString")
+	}
+
+	opts := ParseOptions{SortBy: SortByNone}
+
+	expected, err = ParseStringWithOptions(streamTestNZB, opts)
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	nzb, err = ParseBytesWithOptions([]byte(streamTestNZB), opts)
+	if err != nil {
+		t.Fatalf("ParseBytesWithOptions failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(nzb, expected) {
+		t.Errorf("Expected ParseBytesWithOptions to return the same as ParseStringWithOptions")
+	}
+
+	if _, err := ParseBytes([]byte("This is not a valid NZB file")); !errors.Is(err, ErrInvalidNZB) {
+		t.Errorf("Expected ErrInvalidNZB, got %v", err)
+	}
+}
+
 func TestParseSubjectVariants(t *testing.T) {
 	testCases := []struct {
 		subject string
@@ -204,218 +250,1364 @@ func TestParse(t *testing.T) {
 	}
 }
 
-func TestWriteString(t *testing.T) {
-	nzb := &Nzb{
-		Comment: "Test Comment",
-		Meta: map[string]string{
-			"title":    "Test Title",
-			"category": "Test Category",
-		},
-		Files: []NzbFile{
-			{
-				Poster:  "test@example.com",
-				Date:    1234567890,
-				Subject: "Test Subject",
-				Groups:  []string{"alt.test"},
-				Segments: []NzbSegment{
-					{
-						Bytes:  1234,
-						Number: 1,
-						ID:     "test-segment-1",
-					},
-				},
-			},
-		},
+// cancelReader calls cancel once the given amount of bytes has been read
+type cancelReader struct {
+	data   *strings.Reader
+	after  int
+	read   int
+	cancel context.CancelFunc
+}
+
+func (cr *cancelReader) Read(p []byte) (int, error) {
+	if len(p) > 64 {
+		p = p[:64]
 	}
 
-	output, err := WriteString(nzb)
+	n, err := cr.data.Read(p)
+
+	cr.read += n
+	if cr.read >= cr.after {
+		cr.cancel()
+	}
+
+	return n, err
+}
+
+func TestParseContext(t *testing.T) {
+	validNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="[1/2] Test - &quot;a.txt&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="1234" number="1">test-segment-1</segment></segments>
+  </file>
+  <file poster="test@example.com" date="1234567890" subject="[2/2] Test - &quot;b.txt&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="1234" number="1">test-segment-2</segment></segments>
+  </file>
+</nzb>`
+
+	// Test uncancelled context
+	nzb, err := ParseContext(context.Background(), strings.NewReader(validNZB))
 	if err != nil {
-		t.Fatalf("WriteString failed: %v", err)
+		t.Fatalf("ParseContext failed: %v", err)
 	}
 
-	// Check that output contains expected elements
-	if !strings.Contains(output, "Test Comment") {
-		t.Error("Output doesn't contain comment")
+	if len(nzb.Files) != 2 {
+		t.Errorf("Expected 2 files, got %d", len(nzb.Files))
 	}
 
-	if !strings.Contains(output, "<meta type=\"title\">Test Title</meta>") {
-		t.Error("Output doesn't contain title metadata")
+	// Test already cancelled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = ParseContext(ctx, strings.NewReader(validNZB))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
 	}
 
-	if !strings.Contains(output, "<meta type=\"category\">Test Category</meta>") {
-		t.Error("Output doesn't contain category metadata")
+	// Test context cancelled while decoding
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	reader := &cancelReader{data: strings.NewReader(validNZB), after: strings.Index(validNZB, "</file>"), cancel: cancel}
+
+	nzb, err = ParseContext(ctx, reader)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled for a parse cancelled midway, got %v", err)
 	}
 
-	if !strings.Contains(output, "poster=\"test@example.com\"") {
-		t.Error("Output doesn't contain poster attribute")
+	if nzb != nil {
+		t.Errorf("Expected no partially built nzb, got %+v", nzb)
 	}
 
-	if !strings.Contains(output, "<group>alt.test</group>") {
-		t.Error("Output doesn't contain group")
+	// Test expired deadline
+	ctx, cancelDeadline := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelDeadline()
+
+	_, err = ParseContext(ctx, strings.NewReader(validNZB))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
 	}
+}
 
-	if !strings.Contains(output, "<segment bytes=\"1234\" number=\"1\">test-segment-1</segment>") {
-		t.Error("Output doesn't contain segment")
+func TestParseZip(t *testing.T) {
+	validNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Test - &quot;%s&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="1234" number="1">test-segment-1</segment></segments>
+  </file>
+</nzb>`
+
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+
+	entries := []struct {
+		name    string
+		content string
+	}{
+		{"first.nzb", fmt.Sprintf(validNZB, "a.txt")},
+		{"readme.txt", "not an nzb"},
+		{"broken.nzb", "This is not a valid NZB file"},
+		{"sub/SECOND.NZB", fmt.Sprintf(validNZB, "b.txt")},
+	}
+
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+
+		if _, err := w.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("Failed to write zip entry: %v", err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to write zip archive: %v", err)
+	}
+
+	nzbs, err := ParseZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+
+	// the broken entry is reported without aborting the other entries
+	if !errors.Is(err, ErrInvalidNZB) || !strings.Contains(err.Error(), "broken.nzb") {
+		t.Errorf("Expected ErrInvalidNZB for broken.nzb, got %v", err)
+	}
+
+	if len(nzbs) != 2 || nzbs[0].Files[0].Filename != "a.txt" || nzbs[1].Files[0].Filename != "b.txt" {
+		t.Fatalf("Expected the nzbs of first.nzb and sub/SECOND.NZB, got %+v", nzbs)
+	}
+
+	// not a zip archive
+	if _, err := ParseZip(strings.NewReader("not a zip"), 9); !errors.Is(err, zip.ErrFormat) {
+		t.Errorf("Expected zip.ErrFormat, got %v", err)
 	}
 }
 
-func TestWrite(t *testing.T) {
-	nzb := &Nzb{
-		Meta: map[string]string{
-			"title": "Test Title",
-		},
-		Files: []NzbFile{
-			{
-				Subject: "Test Subject",
-				Groups:  []string{"alt.test"},
-				Segments: []NzbSegment{
-					{
-						Bytes:  1234,
-						Number: 1,
-						ID:     "test-segment-1",
-					},
-				},
-			},
-		},
+func TestParseFile(t *testing.T) {
+	validNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Test - &quot;a.txt&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="1234" number="1">test-segment-1</segment></segments>
+  </file>
+</nzb>`
+
+	dir := t.TempDir()
+
+	// Test plain nzb file
+	plainPath := filepath.Join(dir, "test.nzb")
+	if err := os.WriteFile(plainPath, []byte(validNZB), 0o600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
 	}
 
-	output, err := Write(nzb)
+	nzb, err := ParseFile(plainPath)
 	if err != nil {
-		t.Fatalf("Write failed: %v", err)
+		t.Fatalf("ParseFile failed: %v", err)
 	}
 
-	// Check that output is a valid byte slice
-	if len(output) == 0 {
-		t.Error("Output is empty")
+	if len(nzb.Files) != 1 || nzb.Files[0].Filename != "a.txt" {
+		t.Errorf("Unexpected files parsed: %+v", nzb.Files)
 	}
 
-	// Parse the output to ensure it's valid
-	parsedNzb, err := Parse(bytes.NewReader(output))
+	// Test gzip compressed nzb file
+	var compressed bytes.Buffer
+
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write([]byte(validNZB)); err != nil {
+		t.Fatalf("Failed to compress test file: %v", err)
+	}
+
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Failed to compress test file: %v", err)
+	}
+
+	gzPath := filepath.Join(dir, "test.nzb.gz")
+	if err := os.WriteFile(gzPath, compressed.Bytes(), 0o600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	nzb, err = ParseFile(gzPath)
 	if err != nil {
-		t.Fatalf("Parsing output failed: %v", err)
+		t.Fatalf("ParseFile failed for gzip file: %v", err)
 	}
 
-	if parsedNzb.Meta["title"] != "Test Title" {
-		t.Errorf("Expected title 'Test Title', got '%s'", parsedNzb.Meta["title"])
+	if len(nzb.Files) != 1 {
+		t.Errorf("Expected 1 file, got %d", len(nzb.Files))
+	}
+
+	// Test missing file
+	missingPath := filepath.Join(dir, "missing.nzb")
+
+	_, err = ParseFile(missingPath)
+	if err == nil || !strings.Contains(err.Error(), missingPath) {
+		t.Errorf("Expected error containing the path, got %v", err)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist, got %v", err)
+	}
+
+	// Test invalid nzb file
+	invalidPath := filepath.Join(dir, "invalid.nzb")
+	if err := os.WriteFile(invalidPath, []byte("This is not a valid NZB file"), 0o600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	_, err = ParseFile(invalidPath)
+	if err == nil || !strings.Contains(err.Error(), invalidPath) {
+		t.Errorf("Expected error containing the path, got %v", err)
 	}
 }
 
-func TestScanNzbFile(t *testing.T) {
-	nzb := &Nzb{
-		Files: []NzbFile{
-			{
-				Subject: "[1/2] Test Subject - \"test.txt\" yEnc (1/2)",
-				Segments: []NzbSegment{
-					{
-						Bytes:  1000,
-						Number: 1,
-					},
-					{
-						Bytes:  2000,
-						Number: 2,
-					},
-				},
-			},
-			{
-				Subject: "[2/2] Test Subject - \"test.txt\" yEnc (1/1)",
-				Segments: []NzbSegment{
-					{
-						Bytes:  3000,
-						Number: 1,
-					},
-				},
-			},
-		},
+func TestParseGzip(t *testing.T) {
+	var compressed bytes.Buffer
+
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write([]byte(streamTestNZB)); err != nil {
+		t.Fatalf("Failed to compress nzb: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Failed to compress nzb: %v", err)
 	}
 
-	ScanNzbFile(nzb)
+	// gzip compressed input is detected by default
+	nzb, err := Parse(bytes.NewReader(compressed.Bytes()))
+	if err != nil {
+		t.Fatalf("Parse failed for gzip input: %v", err)
+	}
 
-	// Verify total counts
-	if nzb.TotalFiles != 2 {
-		t.Errorf("Expected TotalFiles 2, got %d", nzb.TotalFiles)
+	if len(nzb.Files) != 3 || nzb.Meta["title"] != "Stream Title" {
+		t.Errorf("Unexpected nzb parsed from gzip input: %+v", nzb)
 	}
 
-	if nzb.Segments != 3 {
-		t.Errorf("Expected Segments 3, got %d", nzb.Segments)
+	// uncompressed input is unaffected by the sniffing
+	nzb, err = Parse(strings.NewReader(streamTestNZB))
+	if err != nil {
+		t.Fatalf("Parse failed for plain input: %v", err)
 	}
 
-	if nzb.Bytes != 6000 {
-		t.Errorf("Expected Bytes 6000, got %d", nzb.Bytes)
+	if len(nzb.Files) != 3 {
+		t.Errorf("Expected 3 files, got %d", len(nzb.Files))
 	}
 
-	// Verify file information
-	if nzb.Files[0].Filename != "test.txt" {
-		t.Errorf("Expected filename 'test.txt', got '%s'", nzb.Files[0].Filename)
+	// the detection is on with custom options as well
+	nzb, err = ParseWithOptions(bytes.NewReader(compressed.Bytes()), ParseOptions{RemoveDuplicates: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed for gzip input: %v", err)
 	}
 
-	if nzb.Files[0].Number != 1 {
-		t.Errorf("Expected file number 1, got %d", nzb.Files[0].Number)
+	if len(nzb.Files) != 3 {
+		t.Errorf("Expected 3 files, got %d", len(nzb.Files))
 	}
 
-	if nzb.Files[0].Bytes != 3000 {
-		t.Errorf("Expected file bytes 3000, got %d", nzb.Files[0].Bytes)
+	// the detection can be disabled
+	_, err = ParseWithOptions(bytes.NewReader(compressed.Bytes()), ParseOptions{RemoveDuplicates: true, DisableGzip: true})
+	if !errors.Is(err, ErrInvalidNZB) {
+		t.Errorf("Expected ErrInvalidNZB without gzip detection, got %v", err)
+	}
+
+	// a broken gzip header is an invalid nzb
+	_, err = Parse(bytes.NewReader([]byte{0x1f, 0x8b, 0x00}))
+	if !errors.Is(err, ErrInvalidNZB) {
+		t.Errorf("Expected ErrInvalidNZB for a broken gzip header, got %v", err)
 	}
 }
 
-func TestScanNzbFileEdgeCases(t *testing.T) {
-	// Test with empty file list
-	emptyNzb := &Nzb{
-		Files: []NzbFile{},
+func TestParseLimits(t *testing.T) {
+	defaults := ParseOptions{RemoveDuplicates: true}
+
+	// limits which are not exceeded
+	opts := defaults
+	opts.MaxBytes = int64(len(streamTestNZB))
+	opts.MaxFiles = 3
+	opts.MaxSegmentsPerFile = 2
+
+	if _, err := ParseStringWithOptions(streamTestNZB, opts); err != nil {
+		t.Errorf("Expected nzb within the limits to parse, got %v", err)
 	}
-	ScanNzbFile(emptyNzb)
 
-	if emptyNzb.TotalFiles != 0 {
-		t.Errorf("Expected TotalFiles 0 for empty nzb, got %d", emptyNzb.TotalFiles)
+	// the largest limit doesn't overflow
+	opts = defaults
+	opts.MaxBytes = math.MaxInt64
+
+	if _, err := ParseStringWithOptions(streamTestNZB, opts); err != nil {
+		t.Errorf("Expected nzb within the largest limit to parse, got %v", err)
 	}
 
-	// Test with invalid subject format that can't be parsed
-	invalidSubjectNzb := &Nzb{
-		Files: []NzbFile{
-			{
-				Subject: "This is not a parseable subject",
-				Segments: []NzbSegment{
-					{
-						Bytes:  1000,
-						Number: 1,
-					},
-				},
-			},
-		},
+	cases := []struct {
+		name   string
+		modify func(*ParseOptions)
+	}{
+		{"bytes", func(o *ParseOptions) { o.MaxBytes = int64(len(streamTestNZB)) / 2 }},
+		{"files", func(o *ParseOptions) { o.MaxFiles = 2 }},
+		{"segments", func(o *ParseOptions) { o.MaxSegmentsPerFile = 1 }},
 	}
-	ScanNzbFile(invalidSubjectNzb)
 
-	// Test with more total files from subject than actual files
-	moreFilesNzb := &Nzb{
-		Files: []NzbFile{
-			{
-				Subject: "[1/10] Test Subject - \"test.txt\" yEnc (1/1)",
-				Segments: []NzbSegment{
-					{
-						Bytes:  1000,
-						Number: 1,
-					},
-				},
-			},
-		},
+	for _, c := range cases {
+		opts := defaults
+		c.modify(&opts)
+
+		_, err := ParseStringWithOptions(streamTestNZB, opts)
+		if !errors.Is(err, ErrTooLarge) {
+			t.Errorf("%s: expected ErrTooLarge, got %v", c.name, err)
+		}
+
+		if errors.Is(err, ErrInvalidNZB) {
+			t.Errorf("%s: expected the error not to be ErrInvalidNZB, got %v", c.name, err)
+		}
 	}
-	ScanNzbFile(moreFilesNzb)
 
-	if moreFilesNzb.TotalFiles != 10 {
-		t.Errorf("Expected TotalFiles 10, got %d", moreFilesNzb.TotalFiles)
+	// the limit applies to the decompressed size
+	var compressed bytes.Buffer
+
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write([]byte(strings.Replace(streamTestNZB, "<head>", strings.Repeat("<!-- padding -->", 1000)+"<head>", 1)))
+	_ = gz.Close()
+
+	opts = defaults
+	opts.MaxBytes = int64(len(streamTestNZB)) + 1000
+
+	if _, err := ParseWithOptions(&compressed, opts); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge for decompressed input, got %v", err)
 	}
 }
 
-func TestMakeUnique(t *testing.T) {
-	// Create NZB with duplicate file entries and segments
-	nzb := &Nzb{
-		Files: []NzbFile{
-			{
-				Subject: "Test Subject",
-				Segments: []NzbSegment{
-					{
-						ID:     "segment-1",
-						Number: 1,
-						Bytes:  1000,
+func TestNamespace(t *testing.T) {
+	body := `>
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Test - &quot;a.rar&quot; yEnc (1/1)">
+    <groups>
+      <group>alt.test</group>
+    </groups>
+    <segments>
+      <segment bytes="100" number="1">a-1</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	cases := []struct {
+		root      string
+		namespace string
+		written   string
+	}{
+		{`<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb"`, Xmlns, Xmlns},
+		{`<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb/"`, Xmlns + "/", Xmlns + "/"},
+		{`<nzb`, "", Xmlns},
+	}
+
+	for _, c := range cases {
+		nzb, err := ParseString(Header + c.root + body)
+		if err != nil {
+			t.Fatalf("%s: ParseString failed: %v", c.root, err)
+		}
+
+		if len(nzb.Files) != 1 || nzb.Files[0].Segments[0].ID != "a-1" {
+			t.Errorf("%s: unexpected files %+v", c.root, nzb.Files)
+		}
+
+		if nzb.Namespace != c.namespace {
+			t.Errorf("%s: namespace got %q want %q", c.root, nzb.Namespace, c.namespace)
+		}
+
+		output, err := WriteString(nzb)
+		if err != nil {
+			t.Fatalf("%s: WriteString failed: %v", c.root, err)
+		}
+
+		if !strings.Contains(output, `<nzb xmlns="`+c.written+`">`) {
+			t.Errorf("%s: expected namespace %q to be written:\n%s", c.root, c.written, output)
+		}
+	}
+}
+
+func TestFileAttributesRoundTrip(t *testing.T) {
+	attrsNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Test - &quot;a.rar&quot; yEnc (1/2)" bytes="300" filehash="d41d8cd98f00b204" source="indexer" added="2024-01-01">
+    <groups>
+      <group>alt.test</group>
+    </groups>
+    <segments>
+      <segment bytes="100" number="1">a-1</segment>
+      <segment bytes="200" number="2">a-2</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	nzb, err := ParseString(attrsNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	file := nzb.Files[0]
+	if file.FileHash != "d41d8cd98f00b204" || file.Bytes != 300 {
+		t.Errorf("Unexpected file hash %q and bytes %d", file.FileHash, file.Bytes)
+	}
+
+	expected := map[string]string{"source": "indexer", "added": "2024-01-01"}
+	if !reflect.DeepEqual(file.Attrs, expected) {
+		t.Errorf("Expected attributes %v, got %v", expected, file.Attrs)
+	}
+
+	output, err := WriteString(nzb)
+	if err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+
+	if !strings.Contains(output, `bytes="300" filehash="d41d8cd98f00b204" added="2024-01-01" source="indexer">`) {
+		t.Errorf("Expected the file attributes to be written:\n%s", output)
+	}
+
+	parsed, err := ParseString(output)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(parsed.Files, nzb.Files) {
+		t.Errorf("Expected the files to survive the round trip, got %+v", parsed.Files)
+	}
+
+	// files without further attributes have none
+	nzb, err = ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if nzb.Files[0].Attrs != nil {
+		t.Errorf("Expected no attributes, got %v", nzb.Files[0].Attrs)
+	}
+}
+
+func TestSegmentAttributesRoundTrip(t *testing.T) {
+	attrsNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Test - &quot;a.rar&quot; yEnc (1/2)">
+    <groups>
+      <group>alt.test</group>
+    </groups>
+    <segments>
+      <segment bytes="100" number="1" server="2" retries="3">a-1</segment>
+      <segment bytes="200" number="2">a-2</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	nzb, err := ParseString(attrsNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	segments := nzb.Files[0].Segments
+	if segments[0].Bytes != 100 || segments[0].Number != 1 || segments[0].ID != "a-1" {
+		t.Errorf("Unexpected segment %+v", segments[0])
+	}
+
+	expected := map[string]string{"server": "2", "retries": "3"}
+	if !reflect.DeepEqual(segments[0].Attrs, expected) {
+		t.Errorf("Expected attributes %v, got %v", expected, segments[0].Attrs)
+	}
+
+	if segments[1].Attrs != nil {
+		t.Errorf("Expected no attributes, got %v", segments[1].Attrs)
+	}
+
+	output, err := WriteString(nzb)
+	if err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+
+	if !strings.Contains(output, `<segment bytes="100" number="1" retries="3" server="2">a-1</segment>`) {
+		t.Errorf("Expected the segment attributes to be written:\n%s", output)
+	}
+
+	parsed, err := ParseString(output)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(parsed.Files[0].Segments, segments) {
+		t.Errorf("Expected the segments to survive the round trip, got %+v", parsed.Files[0].Segments)
+	}
+
+	// clones have their own attributes
+	clone := nzb.Clone()
+	clone.Files[0].Segments[0].Attrs["server"] = "1"
+
+	if nzb.Files[0].Segments[0].Attrs["server"] != "2" {
+		t.Errorf("Expected the attributes of the clone to be independent")
+	}
+}
+
+func TestForceCharset(t *testing.T) {
+	// declared as utf-8 but actually windows-1252 encoded
+	body := "<nzb xmlns=\"http://www.newzbin.com/DTD/2003/nzb\">\n" +
+		"  <file poster=\"Caf\xe9\" date=\"1234567890\" subject=\"[1/1] Caf\xe9 - &quot;caf\xe9.rar&quot; yEnc (1/1)\">\n" +
+		"    <groups><group>alt.test</group></groups>\n" +
+		"    <segments><segment bytes=\"100\" number=\"1\">a-1</segment></segments>\n" +
+		"  </file>\n" +
+		"</nzb>"
+	mislabeled := Header + body
+
+	if _, err := ParseString(mislabeled); !errors.Is(err, ErrInvalidNZB) {
+		t.Errorf("Expected ErrInvalidNZB for mislabeled input by default, got %v", err)
+	}
+
+	opts := ParseOptions{RemoveDuplicates: true, ForceCharset: "windows-1252"}
+
+	nzb, err := ParseStringWithOptions(mislabeled, opts)
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	if nzb.Files[0].Poster != "Café" || nzb.Files[0].Filename != "café.rar" {
+		t.Errorf("Expected forced charset to be decoded, got poster %q and filename %q", nzb.Files[0].Poster, nzb.Files[0].Filename)
+	}
+
+	// a correct declaration is not converted twice
+	declared := `<?xml version="1.0" encoding="windows-1252" ?>` + "\n" + body
+
+	nzb, err = ParseStringWithOptions(declared, opts)
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	if nzb.Files[0].Poster != "Café" {
+		t.Errorf("Expected poster 'Café', got %q", nzb.Files[0].Poster)
+	}
+
+	// utf-8 input forced as windows-1252 is garbled, so the option really overrides the declaration
+	nzb, err = ParseStringWithOptions(strings.ReplaceAll(mislabeled, "\xe9", "é"), opts)
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	if nzb.Files[0].Poster != "CafÃ©" {
+		t.Errorf("Expected garbled poster 'CafÃ©', got %q", nzb.Files[0].Poster)
+	}
+
+	if _, err := ParseStringWithOptions(streamTestNZB, ParseOptions{ForceCharset: "no-such-charset"}); err == nil {
+		t.Error("Expected error for an unknown charset, got nil")
+	}
+}
+
+func TestWriteString(t *testing.T) {
+	nzb := &Nzb{
+		Comment: "Test Comment",
+		Meta: map[string]string{
+			"title":    "Test Title",
+			"category": "Test Category",
+		},
+		Files: []NzbFile{
+			{
+				Poster:  "test@example.com",
+				Date:    1234567890,
+				Subject: "Test Subject",
+				Groups:  []string{"alt.test"},
+				Segments: []NzbSegment{
+					{
+						Bytes:  1234,
+						Number: 1,
+						ID:     "test-segment-1",
+					},
+				},
+			},
+		},
+	}
+
+	output, err := WriteString(nzb)
+	if err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+
+	// Check that output contains expected elements
+	if !strings.Contains(output, "Test Comment") {
+		t.Error("Output doesn't contain comment")
+	}
+
+	if !strings.Contains(output, "<meta type=\"title\">Test Title</meta>") {
+		t.Error("Output doesn't contain title metadata")
+	}
+
+	if !strings.Contains(output, "<meta type=\"category\">Test Category</meta>") {
+		t.Error("Output doesn't contain category metadata")
+	}
+
+	if !strings.Contains(output, "poster=\"test@example.com\"") {
+		t.Error("Output doesn't contain poster attribute")
+	}
+
+	if !strings.Contains(output, "<group>alt.test</group>") {
+		t.Error("Output doesn't contain group")
+	}
+
+	if !strings.Contains(output, "<segment bytes=\"1234\" number=\"1\">test-segment-1</segment>") {
+		t.Error("Output doesn't contain segment")
+	}
+}
+
+func TestWriteStringEscaping(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{
+				Poster:   "test@example.com",
+				Date:     1234567890,
+				Subject:  `Tom & Jerry <1> - "file.rar" yEnc (1/1)`,
+				Groups:   []string{"alt.test"},
+				Segments: []NzbSegment{{Bytes: 1234, Number: 1, ID: "part&1<x>@example.com"}},
+			},
+		},
+	}
+
+	output, err := WriteString(nzb)
+	if err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+
+	if !strings.Contains(output, ">part&amp;1&lt;x&gt;@example.com</segment>") {
+		t.Errorf("Expected the escaped segment id:\n%s", output)
+	}
+
+	if !strings.Contains(output, `subject="Tom &amp; Jerry &lt;1&gt; - &#34;file.rar&#34; yEnc (1/1)"`) {
+		t.Errorf("Expected the escaped subject:\n%s", output)
+	}
+
+	parsed, err := ParseString(output)
+	if err != nil {
+		t.Fatalf("Parse of the written nzb failed: %v", err)
+	}
+
+	if got := parsed.Files[0].Segments[0].ID; got != nzb.Files[0].Segments[0].ID {
+		t.Errorf("Expected segment id %q after the round-trip, got %q", nzb.Files[0].Segments[0].ID, got)
+	}
+
+	if got := parsed.Files[0].Subject; got != nzb.Files[0].Subject {
+		t.Errorf("Expected subject %q after the round-trip, got %q", nzb.Files[0].Subject, got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	nzb := &Nzb{
+		Meta: map[string]string{
+			"title": "Test Title",
+		},
+		Files: []NzbFile{
+			{
+				Subject: "Test Subject",
+				Groups:  []string{"alt.test"},
+				Segments: []NzbSegment{
+					{
+						Bytes:  1234,
+						Number: 1,
+						ID:     "test-segment-1",
+					},
+				},
+			},
+		},
+	}
+
+	output, err := Write(nzb)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// Check that output is a valid byte slice
+	if len(output) == 0 {
+		t.Error("Output is empty")
+	}
+
+	// Parse the output to ensure it's valid
+	parsedNzb, err := Parse(bytes.NewReader(output))
+	if err != nil {
+		t.Fatalf("Parsing output failed: %v", err)
+	}
+
+	if parsedNzb.Meta["title"] != "Test Title" {
+		t.Errorf("Expected title 'Test Title', got '%s'", parsedNzb.Meta["title"])
+	}
+}
+
+func TestWriteIndentation(t *testing.T) {
+	nzb, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	defaultOutput, err := Write(nzb)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if !bytes.Contains(defaultOutput, []byte("\n  <head>\n    <meta")) {
+		t.Errorf("Expected two space indentation by default:\n%s", defaultOutput)
+	}
+
+	output, err := WriteWithOptions(nzb, WriteOptions{Indent: "    "})
+	if err != nil {
+		t.Fatalf("WriteWithOptions failed: %v", err)
+	}
+
+	if !bytes.Contains(output, []byte("\n    <head>\n        <meta")) {
+		t.Errorf("Expected four space indentation:\n%s", output)
+	}
+
+	output, err = WriteWithOptions(nzb, WriteOptions{Compact: true})
+	if err != nil {
+		t.Fatalf("WriteWithOptions failed: %v", err)
+	}
+
+	body := bytes.TrimPrefix(output, []byte(Header))
+	if bytes.Contains(body, []byte("\n")) {
+		t.Errorf("Expected compact output on a single line:\n%s", output)
+	}
+
+	if len(output) >= len(defaultOutput) {
+		t.Errorf("Expected compact output to be smaller than the indented output")
+	}
+
+	// all variants parse to the same nzb, the files read back declare the written bytes and have the written order
+	for id := range nzb.Files {
+		file := &nzb.Files[id]
+		file.DeclaredBytes = file.Bytes
+		file.position = id + 1
+
+		for sid := range file.Segments {
+			file.Segments[sid].position = sid + 1
+		}
+	}
+
+	for _, data := range [][]byte{defaultOutput, output} {
+		parsed, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+
+		if !reflect.DeepEqual(parsed.Files, nzb.Files) {
+			t.Errorf("Expected the written files to parse back unchanged")
+		}
+	}
+}
+
+func TestWriteOmitHeader(t *testing.T) {
+	nzb, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	cases := []struct {
+		opts        WriteOptions
+		declaration bool
+		doctype     bool
+	}{
+		{WriteOptions{}, true, true},
+		{WriteOptions{OmitHeader: true}, true, false},
+		{WriteOptions{OmitXMLDeclaration: true}, false, true},
+		{WriteOptions{OmitHeader: true, OmitXMLDeclaration: true}, false, false},
+	}
+
+	for _, c := range cases {
+		output, err := WriteWithOptions(nzb, c.opts)
+		if err != nil {
+			t.Fatalf("%+v: WriteWithOptions failed: %v", c.opts, err)
+		}
+
+		if got := bytes.Contains(output, []byte("<?xml")); got != c.declaration {
+			t.Errorf("%+v: xml declaration present %v, want %v", c.opts, got, c.declaration)
+		}
+
+		if got := bytes.Contains(output, []byte("<!DOCTYPE")); got != c.doctype {
+			t.Errorf("%+v: doctype present %v, want %v", c.opts, got, c.doctype)
+		}
+
+		if !c.declaration && !c.doctype && !bytes.HasPrefix(output, []byte("<nzb ")) {
+			t.Errorf("%+v: expected output to start with the nzb root:\n%s", c.opts, output)
+		}
+
+		// our own output must parse again
+		parsed, err := Parse(bytes.NewReader(output))
+		if err != nil {
+			t.Fatalf("%+v: Parse failed: %v", c.opts, err)
+		}
+
+		if len(parsed.Files) != len(nzb.Files) {
+			t.Errorf("%+v: expected %d files, got %d", c.opts, len(nzb.Files), len(parsed.Files))
+		}
+	}
+}
+
+func TestWriteCustomHeader(t *testing.T) {
+	nzb, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	header := "<?xml version=\"1.0\" encoding=\"utf-8\" standalone=\"yes\"?>\n"
+
+	// the custom header replaces the default one, the omit options are ignored
+	output, err := WriteWithOptions(nzb, WriteOptions{Header: header, OmitXMLDeclaration: true})
+	if err != nil {
+		t.Fatalf("WriteWithOptions failed: %v", err)
+	}
+
+	if !bytes.HasPrefix(output, []byte(header+"<nzb ")) {
+		t.Errorf("Expected output to start with the custom header:\n%s", output)
+	}
+
+	if bytes.Contains(output, []byte("<!DOCTYPE")) {
+		t.Errorf("Expected the default doctype to be replaced:\n%s", output)
+	}
+
+	parsed, err := Parse(bytes.NewReader(output))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if len(parsed.Files) != len(nzb.Files) {
+		t.Errorf("Expected %d files, got %d", len(nzb.Files), len(parsed.Files))
+	}
+}
+
+func TestWriteSegmentAttributes(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{
+				Poster:   "test@example.com",
+				Date:     1234567890,
+				Subject:  "Test Subject",
+				Groups:   []string{"alt.test"},
+				Bytes:    100,
+				Segments: []NzbSegment{{Bytes: 100, Number: 1, ID: "a-1"}, {Number: 2, ID: "a-2"}},
+			},
+		},
+	}
+
+	golden := func(segments string) string {
+		return xmlDeclaration + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <head></head>
+  <file poster="test@example.com" date="1234567890" subject="Test Subject" bytes="100" filehash="">
+    <groups>
+      <group>alt.test</group>
+    </groups>
+    <segments>
+` + segments + `
+    </segments>
+  </file>
+</nzb>`
+	}
+
+	cases := []struct {
+		opts     WriteOptions
+		segments string
+	}{
+		{
+			WriteOptions{OmitHeader: true},
+			`      <segment bytes="100" number="1">a-1</segment>
+      <segment number="2">a-2</segment>`,
+		},
+		{
+			WriteOptions{OmitHeader: true, SegmentNumberFirst: true},
+			`      <segment number="1" bytes="100">a-1</segment>
+      <segment number="2">a-2</segment>`,
+		},
+	}
+
+	for _, c := range cases {
+		output, err := WriteWithOptions(nzb, c.opts)
+		if err != nil {
+			t.Fatalf("%+v: WriteWithOptions failed: %v", c.opts, err)
+		}
+
+		if expected := golden(c.segments); string(output) != expected {
+			t.Errorf("%+v: unexpected output:\n%s\nwant:\n%s", c.opts, output, expected)
+		}
+
+		// the omitted byte count is parsed as 0
+		parsed, err := ParseBytes(output)
+		if err != nil {
+			t.Fatalf("%+v: ParseBytes failed: %v", c.opts, err)
+		}
+
+		if segments := parsed.Files[0].Segments; segments[0].Bytes != 100 || segments[1].Bytes != 0 || segments[1].Number != 2 {
+			t.Errorf("%+v: unexpected segments after the round trip: %+v", c.opts, segments)
+		}
+	}
+}
+
+func TestWriteSorted(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Number: 2, Subject: "b", Groups: []string{"alt.test"}, Segments: NzbSegments{{Number: 2, ID: "b-2"}, {Number: 1, ID: "b-1"}}},
+			{Number: 1, Subject: "a", Groups: []string{"alt.test"}, Segments: NzbSegments{{Number: 1, ID: "a-1"}}},
+		},
+	}
+
+	order := func(output []byte, ids ...string) bool {
+		last := -1
+
+		for _, id := range ids {
+			idx := bytes.Index(output, []byte(">"+id+"<"))
+			if idx < last {
+				return false
+			}
+
+			last = idx
+		}
+
+		return true
+	}
+
+	// the segments are sorted by default, the files only on request
+	output, err := Write(nzb)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if !order(output, "b-1", "b-2", "a-1") {
+		t.Errorf("Expected the segments to be sorted:\n%s", output)
+	}
+
+	output, err = WriteWithOptions(nzb, WriteOptions{SortFiles: true})
+	if err != nil {
+		t.Fatalf("WriteWithOptions failed: %v", err)
+	}
+
+	if !order(output, "a-1", "b-1", "b-2") {
+		t.Errorf("Expected the files and segments to be sorted:\n%s", output)
+	}
+
+	output, err = WriteWithOptions(nzb, WriteOptions{KeepSegmentOrder: true})
+	if err != nil {
+		t.Fatalf("WriteWithOptions failed: %v", err)
+	}
+
+	if !order(output, "b-2", "b-1", "a-1") {
+		t.Errorf("Expected the order to be kept:\n%s", output)
+	}
+
+	// the nzb is not changed
+	if nzb.Files[0].Number != 2 || nzb.Files[0].Segments[0].Number != 2 {
+		t.Errorf("Expected the nzb to keep its order, got %+v", nzb.Files)
+	}
+}
+
+func TestWriteNormalizeGroups(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: "a", Groups: []string{"alt.test", "alt.bin", "alt.bin"}, Segments: NzbSegments{{Number: 1, ID: "a-1"}}},
+		},
+	}
+
+	output, err := WriteWithOptions(nzb, WriteOptions{NormalizeGroups: true})
+	if err != nil {
+		t.Fatalf("WriteWithOptions failed: %v", err)
+	}
+
+	parsed, err := ParseWithOptions(bytes.NewReader(output), ParseOptions{})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+
+	if expected := []string{"alt.bin", "alt.test"}; !reflect.DeepEqual(parsed.Files[0].Groups, expected) {
+		t.Errorf("Expected groups %q, got %q", expected, parsed.Files[0].Groups)
+	}
+
+	// the groups of the nzb are not changed
+	if expected := []string{"alt.test", "alt.bin", "alt.bin"}; !reflect.DeepEqual(nzb.Files[0].Groups, expected) {
+		t.Errorf("Expected the groups of the nzb to be unchanged, got %q", nzb.Files[0].Groups)
+	}
+
+	// written verbatim by default
+	output, err = Write(nzb)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if got := bytes.Count(output, []byte("<group>alt.bin</group>")); got != 2 {
+		t.Errorf("Expected the duplicate group to be written by default, got %d\n%s", got, output)
+	}
+}
+
+func TestPreserveInputOrder(t *testing.T) {
+	// the ids in the order of the input
+	ids := regexp.MustCompile(`>(seg-\d+-\d)<`)
+	order := func(data []byte) []string {
+		var found []string
+		for _, m := range ids.FindAllSubmatch(data, -1) {
+			found = append(found, string(m[1]))
+		}
+
+		return found
+	}
+
+	input := order([]byte(streamTestNZB))
+
+	for _, opts := range []ParseOptions{{NoSort: true}, {}} {
+		nzb, err := ParseWithOptions(strings.NewReader(streamTestNZB), opts)
+		if err != nil {
+			t.Fatalf("ParseWithOptions failed: %v", err)
+		}
+
+		output, err := WriteWithOptions(nzb, WriteOptions{PreserveInputOrder: true, SortFiles: true})
+		if err != nil {
+			t.Fatalf("WriteWithOptions failed: %v", err)
+		}
+
+		if got := order(output); !reflect.DeepEqual(got, input) {
+			t.Errorf("NoSort=%v: expected the input order %q, got %q", opts.NoSort, input, got)
+		}
+	}
+
+	// without the positions of a parse the sort options apply
+	built := &Nzb{
+		Files: []NzbFile{
+			{Number: 2, Subject: "b", Groups: []string{"alt.test"}, Segments: NzbSegments{{Number: 2, ID: "seg-2-2"}, {Number: 1, ID: "seg-2-1"}}},
+			{Number: 1, Subject: "a", Groups: []string{"alt.test"}, Segments: NzbSegments{{Number: 1, ID: "seg-1-1"}}},
+		},
+	}
+
+	output, err := WriteWithOptions(built, WriteOptions{PreserveInputOrder: true, SortFiles: true})
+	if err != nil {
+		t.Fatalf("WriteWithOptions failed: %v", err)
+	}
+
+	if got, expected := order(output), []string{"seg-1-1", "seg-2-1", "seg-2-2"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the sorted order %q, got %q", expected, got)
+	}
+
+	// merged nzbs keep the order of the concatenation
+	first, _ := ParseString(streamTestNZB)
+	second, _ := ParseString(strings.ReplaceAll(strings.ReplaceAll(streamTestNZB, "seg-", "seg-9"), "&quot;file", "&quot;other"))
+
+	output, err = WriteWithOptions(Merge(first, second), WriteOptions{PreserveInputOrder: true})
+	if err != nil {
+		t.Fatalf("WriteWithOptions failed: %v", err)
+	}
+
+	expected := append([]string(nil), input...)
+	for _, id := range input {
+		expected = append(expected, strings.Replace(id, "seg-", "seg-9", 1))
+	}
+
+	if got := order(output); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the merged files in the input order %q, got %q", expected, got)
+	}
+}
+
+func TestWriteDeterministicMeta(t *testing.T) {
+	nzb := &Nzb{
+		Meta: map[string]string{
+			"title":    "Test Title",
+			"category": "Test Category",
+			"password": "second",
+			"name":     "Test Name",
+			"tag":      "Test Tag",
+		},
+		MetaMulti: map[string][]string{
+			"password": {"second", "first"},
+		},
+		Files: []NzbFile{
+			{
+				Subject:  "Test Subject",
+				Groups:   []string{"alt.test"},
+				Segments: []NzbSegment{{Bytes: 1234, Number: 1, ID: "test-segment-1"}},
+			},
+		},
+	}
+
+	first, err := Write(nzb)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		output, err := Write(nzb)
+		if err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		if !bytes.Equal(first, output) {
+			t.Fatal("Expected identical output for identical input")
+		}
+	}
+
+	// types are sorted, the values of a type keep their order
+	expected := []string{
+		`<meta type="category">Test Category</meta>`,
+		`<meta type="name">Test Name</meta>`,
+		`<meta type="password">second</meta>`,
+		`<meta type="password">first</meta>`,
+		`<meta type="tag">Test Tag</meta>`,
+		`<meta type="title">Test Title</meta>`,
+	}
+
+	last := -1
+	for _, element := range expected {
+		index := bytes.Index(first, []byte(element))
+		if index <= last {
+			t.Fatalf("Expected %s after the previous meta element in:\n%s", element, first)
+		}
+		last = index
+	}
+
+	// the first value is still the one of Meta after parsing again
+	parsed, err := Parse(bytes.NewReader(first))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if parsed.Meta["password"] != "second" {
+		t.Errorf("Expected password meta 'second', got %q", parsed.Meta["password"])
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	nzb := &Nzb{
+		Comment: "Test Comment",
+		Meta: map[string]string{
+			"title": "Test Title",
+		},
+		Files: []NzbFile{
+			{
+				Subject: "Test Subject",
+				Groups:  []string{"alt.test"},
+				Segments: []NzbSegment{
+					{
+						Bytes:  1234,
+						Number: 1,
+						ID:     "test-segment-1",
+					},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+
+	n, err := WriteTo(&buf, nzb)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+
+	if n != int64(buf.Len()) {
+		t.Errorf("Expected %d bytes written, got %d", buf.Len(), n)
+	}
+
+	if !strings.HasPrefix(buf.String(), Header) {
+		t.Error("Output doesn't start with the header")
+	}
+
+	if !strings.Contains(buf.String(), "<!-- Test Comment -->") {
+		t.Error("Output doesn't contain the space padded comment")
+	}
+
+	// output must be identical to Write
+	output, err := Write(nzb)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if !bytes.Equal(output, buf.Bytes()) {
+		t.Errorf("WriteTo output differs from Write output:\n%s\n%s", buf.String(), output)
+	}
+
+	// errors from the writer are returned
+	if _, err := WriteTo(errorWriter{}, nzb); err == nil {
+		t.Error("Expected error from writer, got nil")
+	}
+}
+
+// errorWriter is a mock writer that always returns an error
+type errorWriter struct{}
+
+func (ew errorWriter) Write(_ []byte) (int, error) {
+	return 0, fmt.Errorf("mock write error")
+}
+
+func TestScanNzbFile(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{
+				Subject: "[1/2] Test Subject - \"test.txt\" yEnc (1/2)",
+				Segments: []NzbSegment{
+					{
+						Bytes:  1000,
+						Number: 1,
+					},
+					{
+						Bytes:  2000,
+						Number: 2,
+					},
+				},
+			},
+			{
+				Subject: "[2/2] Test Subject - \"test.txt\" yEnc (1/1)",
+				Segments: []NzbSegment{
+					{
+						Bytes:  3000,
+						Number: 1,
+					},
+				},
+			},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	// Verify total counts
+	if nzb.TotalFiles != 2 {
+		t.Errorf("Expected TotalFiles 2, got %d", nzb.TotalFiles)
+	}
+
+	if nzb.Segments != 3 {
+		t.Errorf("Expected Segments 3, got %d", nzb.Segments)
+	}
+
+	if nzb.Bytes != 6000 {
+		t.Errorf("Expected Bytes 6000, got %d", nzb.Bytes)
+	}
+
+	// Verify file information
+	if nzb.Files[0].Filename != "test.txt" {
+		t.Errorf("Expected filename 'test.txt', got '%s'", nzb.Files[0].Filename)
+	}
+
+	if nzb.Files[0].Basefilename != "test" {
+		t.Errorf("Expected basefilename 'test', got '%s'", nzb.Files[0].Basefilename)
+	}
+
+	if nzb.Files[0].Number != 1 {
+		t.Errorf("Expected file number 1, got %d", nzb.Files[0].Number)
+	}
+
+	if nzb.Files[0].Bytes != 3000 {
+		t.Errorf("Expected file bytes 3000, got %d", nzb.Files[0].Bytes)
+	}
+}
+
+func TestScanNzbFileEdgeCases(t *testing.T) {
+	// Test with empty file list
+	emptyNzb := &Nzb{
+		Files: []NzbFile{},
+	}
+	ScanNzbFile(emptyNzb)
+
+	if emptyNzb.TotalFiles != 0 {
+		t.Errorf("Expected TotalFiles 0 for empty nzb, got %d", emptyNzb.TotalFiles)
+	}
+
+	// Test with invalid subject format that can't be parsed
+	invalidSubjectNzb := &Nzb{
+		Files: []NzbFile{
+			{
+				Subject: "This is not a parseable subject",
+				Segments: []NzbSegment{
+					{
+						Bytes:  1000,
+						Number: 1,
+					},
+				},
+			},
+		},
+	}
+	ScanNzbFile(invalidSubjectNzb)
+
+	// Test with more total files from subject than actual files
+	moreFilesNzb := &Nzb{
+		Files: []NzbFile{
+			{
+				Subject: "[1/10] Test Subject - \"test.txt\" yEnc (1/1)",
+				Segments: []NzbSegment{
+					{
+						Bytes:  1000,
+						Number: 1,
+					},
+				},
+			},
+		},
+	}
+	ScanNzbFile(moreFilesNzb)
+
+	if moreFilesNzb.TotalFiles != 10 {
+		t.Errorf("Expected TotalFiles 10, got %d", moreFilesNzb.TotalFiles)
+	}
+}
+
+func TestScanZeroSegmentTotal(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{
+				// malformed posting tools state a segment total of zero
+				Subject: "Test - file.mkv (1/0)",
+				Segments: []NzbSegment{
+					{Bytes: 100, Number: 1, ID: "a-1"},
+					{Bytes: 100, Number: 2, ID: "a-2"},
+					{Bytes: 100, Number: 3, ID: "a-3"},
+				},
+			},
+			{
+				// subject states fewer segments than present
+				Subject: "[2/2] Test - \"file.par2\" yEnc (1/1)",
+				Segments: []NzbSegment{
+					{Bytes: 100, Number: 1, ID: "b-1"},
+					{Bytes: 100, Number: 2, ID: "b-2"},
+				},
+			},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	if nzb.Files[0].TotalSegments != 3 {
+		t.Errorf("Expected 3 total segments for a zero subject total, got %d", nzb.Files[0].TotalSegments)
+	}
+
+	if nzb.Files[1].TotalSegments != 2 {
+		t.Errorf("Expected 2 total segments for a too small subject total, got %d", nzb.Files[1].TotalSegments)
+	}
+
+	if nzb.TotalSegments != 5 {
+		t.Errorf("Expected 5 total segments, got %d", nzb.TotalSegments)
+	}
+
+	// the subject parser itself stays unaware of the segments
+	subject, _ := ParseSubject(nzb.Files[0].Subject)
+	if subject.TotalSegments != 1 {
+		t.Errorf("Expected the subject parser to default to 1 total segment, got %d", subject.TotalSegments)
+	}
+}
+
+func TestLargeSegmentBytes(t *testing.T) {
+	// malformed nzbs sometimes put the whole file size into a segment
+	nzb, err := ParseString(Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Large - &quot;large.mkv&quot; yEnc (1/2)">
+    <groups>
+      <group>alt.test</group>
+    </groups>
+    <segments>
+      <segment bytes="5000000000" number="1">large-1</segment>
+      <segment bytes="4000000000" number="2">large-2</segment>
+    </segments>
+  </file>
+</nzb>`)
+	if err != nil {
+		t.Fatalf("Failed to parse nzb: %v", err)
+	}
+
+	if nzb.Files[0].Segments[0].Bytes != 5000000000 {
+		t.Errorf("Expected segment bytes 5000000000, got %d", nzb.Files[0].Segments[0].Bytes)
+	}
+
+	if nzb.Bytes != 9000000000 {
+		t.Errorf("Expected total bytes 9000000000, got %d", nzb.Bytes)
+	}
+}
+
+func TestMakeUnique(t *testing.T) {
+	// Create NZB with duplicate file entries and segments
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{
+				Subject: "Test Subject",
+				Segments: []NzbSegment{
+					{
+						ID:     "segment-1",
+						Number: 1,
+						Bytes:  1000,
 					},
 					{
 						ID:     "segment-2",
@@ -484,6 +1676,454 @@ func TestMakeUnique(t *testing.T) {
 	}
 }
 
+func TestMergeDuplicateFiles(t *testing.T) {
+	splitNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="first@example.com" date="1234567890" subject="[1/1] Test - &quot;a.rar&quot; yEnc (1/3)">
+    <groups><group>alt.first</group></groups>
+    <segments>
+      <segment bytes="100" number="1">segment-1</segment>
+      <segment bytes="100" number="2">segment-2</segment>
+    </segments>
+  </file>
+  <file poster="second@example.com" date="1234567891" subject="[1/1] Test - &quot;a.rar&quot; yEnc (1/3)">
+    <groups><group>alt.second</group></groups>
+    <segments>
+      <segment bytes="100" number="2">segment-2</segment>
+      <segment bytes="100" number="3">segment-3</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	// default behavior discards the duplicate file
+	nzb, err := ParseString(splitNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if len(nzb.Files) != 1 || len(nzb.Files[0].Segments) != 2 {
+		t.Fatalf("Expected 1 file with 2 segments, got %+v", nzb.Files)
+	}
+
+	// merging keeps the segments of the duplicate file
+	nzb, err = ParseStringWithOptions(splitNZB, ParseOptions{RemoveDuplicates: true, MergeDuplicateFiles: true})
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	if len(nzb.Files) != 1 {
+		t.Fatalf("Expected 1 file, got %d", len(nzb.Files))
+	}
+
+	file := nzb.Files[0]
+	if len(file.Segments) != 3 {
+		t.Fatalf("Expected 3 merged segments, got %+v", file.Segments)
+	}
+
+	for i, id := range []string{"segment-1", "segment-2", "segment-3"} {
+		if file.Segments[i].ID != id {
+			t.Errorf("Expected segment %d to be %q, got %q", i, id, file.Segments[i].ID)
+		}
+	}
+
+	if file.Poster != "first@example.com" || file.Date != 1234567890 || len(file.Groups) != 1 || file.Groups[0] != "alt.first" {
+		t.Errorf("Expected the first occurrence's poster, date and groups, got %q, %d, %v", file.Poster, file.Date, file.Groups)
+	}
+
+	if nzb.Segments != 3 || nzb.Bytes != 300 {
+		t.Errorf("Unexpected totals: %d segments, %d bytes", nzb.Segments, nzb.Bytes)
+	}
+}
+
+func TestDedupKey(t *testing.T) {
+	repostNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1" subject="[1/2] Release - &quot;a.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a-1</segment></segments>
+  </file>
+  <file poster="test@example.com" date="2" subject="[1/2] Release (repost) - &quot;a.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a-2</segment></segments>
+  </file>
+  <file poster="test@example.com" date="3" subject="[2/2] Release - &quot;b.rar&quot; yEnc (1/2)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="1">b-1</segment>
+      <segment bytes="100" number="2">b-2</segment>
+    </segments>
+  </file>
+  <file poster="test@example.com" date="4" subject="[2/2] Release - &quot;renamed.rar&quot; yEnc (1/2)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="2">b-2</segment>
+      <segment bytes="100" number="1">b-1</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	cases := []struct {
+		key   DedupKey
+		dates []int
+	}{
+		{DedupBySubject, []int{1, 2, 3, 4}},
+		{DedupByFilename, []int{1, 3, 4}},
+		{DedupBySegmentSet, []int{1, 2, 3}},
+	}
+
+	for _, c := range cases {
+		nzb, err := ParseStringWithOptions(repostNZB, ParseOptions{RemoveDuplicates: true, DedupKey: c.key, NoSort: true})
+		if err != nil {
+			t.Fatalf("%d: ParseStringWithOptions failed: %v", c.key, err)
+		}
+
+		var dates []int
+		for _, file := range nzb.Files {
+			dates = append(dates, file.Date)
+		}
+
+		if !reflect.DeepEqual(dates, c.dates) {
+			t.Errorf("%d: expected the files %v to be kept, got %v", c.key, c.dates, dates)
+		}
+	}
+}
+
+func TestPreferLargerSegments(t *testing.T) {
+	repostNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Test - &quot;a.rar&quot; yEnc (1/2)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="50" number="1">segment-1</segment>
+      <segment bytes="100" number="2">segment-2</segment>
+      <segment bytes="100" number="1">segment-1</segment>
+      <segment bytes="80" number="2">segment-2</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	// default behavior keeps the first occurrence
+	nzb, err := ParseString(repostNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if nzb.Bytes != 150 {
+		t.Errorf("Expected 150 bytes with the first occurrences, got %d", nzb.Bytes)
+	}
+
+	nzb, err = ParseStringWithOptions(repostNZB, ParseOptions{RemoveDuplicates: true, PreferLargerSegments: true})
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	segments := nzb.Files[0].Segments
+	if len(segments) != 2 || segments[0].Bytes != 100 || segments[1].Bytes != 100 {
+		t.Errorf("Expected the larger segments to be kept, got %+v", segments)
+	}
+
+	if nzb.Bytes != 200 {
+		t.Errorf("Expected 200 bytes with the larger segments, got %d", nzb.Bytes)
+	}
+}
+
+func TestCaseFoldSegmentIDs(t *testing.T) {
+	repostNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="[1/2] Test - &quot;a.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="1">Part1.Abc@Example.com</segment>
+      <segment bytes="100" number="1">part1.abc@example.com</segment>
+    </segments>
+  </file>
+  <file poster="test@example.com" date="1234567890" subject="[2/2] Test - &quot;b.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="1">PART1.ABC@EXAMPLE.COM</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	// message-ids are case-sensitive by default
+	nzb, err := ParseStringWithOptions(repostNZB, ParseOptions{RemoveDuplicates: true, GlobalDedup: true})
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	if nzb.Segments != 3 {
+		t.Errorf("Expected 3 segments without case folding, got %d", nzb.Segments)
+	}
+
+	nzb, err = ParseStringWithOptions(repostNZB, ParseOptions{RemoveDuplicates: true, CaseFoldSegmentIDs: true})
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	segments := nzb.Files[0].Segments
+	if len(segments) != 1 || segments[0].ID != "Part1.Abc@Example.com" {
+		t.Errorf("Expected the first segment with its original case, got %+v", segments)
+	}
+
+	// across files with GlobalDedup
+	nzb, err = ParseStringWithOptions(repostNZB, ParseOptions{RemoveDuplicates: true, GlobalDedup: true, CaseFoldSegmentIDs: true})
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	if nzb.Segments != 1 || len(nzb.Files[1].Segments) != 0 {
+		t.Errorf("Expected a single segment across the files, got %d", nzb.Segments)
+	}
+}
+
+func TestStableSort(t *testing.T) {
+	input := `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">`
+
+	// obfuscated files numbered 2 and 1 alternately, files with equal numbers must keep their order
+	// more than 12 files are required as smaller slices are insertion sorted which is stable anyway
+	var expected []string
+
+	for i := 0; i < 40; i++ {
+		number := 2 - i%2
+		subject := fmt.Sprintf("[%d/2] file%02d yEnc (1/1)", number, i)
+
+		if number == 1 {
+			expected = append(expected, subject)
+		}
+
+		input += fmt.Sprintf(`<file poster="poster" date="1" subject="%s">
+  <groups><group>alt.test</group></groups>
+  <segments>
+    <segment bytes="1" number="%d">%02d-a@test</segment>
+    <segment bytes="1" number="1">%02d-b@test</segment>
+  </segments>
+</file>`, subject, number, i, i)
+	}
+
+	input += `</nzb>`
+
+	for i := 0; i < 40; i++ {
+		if i%2 == 0 {
+			expected = append(expected, fmt.Sprintf("[2/2] file%02d yEnc (1/1)", i))
+		}
+	}
+
+	nzb, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	for i, subject := range expected {
+		if nzb.Files[i].Subject != subject {
+			t.Errorf("Expected file %d to be %q, got %q", i, subject, nzb.Files[i].Subject)
+		}
+	}
+
+	// segments with equal numbers keep their order as well
+	for _, file := range nzb.Files {
+		if file.Number == 1 && !strings.HasSuffix(file.Segments[0].ID, "-a@test") {
+			t.Errorf("Expected the segment order of %q to be kept, got %+v", file.Subject, file.Segments)
+		}
+	}
+}
+
+func TestSortBy(t *testing.T) {
+	// obfuscated posts without file numbers
+	unnumberedNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="&quot;c.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">c-1</segment></segments>
+  </file>
+  <file poster="test@example.com" date="1234567890" subject="&quot;a.par2&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a-1</segment></segments>
+  </file>
+  <file poster="test@example.com" date="1234567890" subject="&quot;b.rar&quot; yEnc (1/2)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="2">b-2</segment>
+      <segment bytes="100" number="1">b-1</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	filenames := func(nzb *Nzb) []string {
+		var names []string
+		for _, file := range nzb.Files {
+			names = append(names, file.Filename)
+		}
+		return names
+	}
+
+	nzb, err := ParseStringWithOptions(unnumberedNZB, ParseOptions{SortBy: SortByFilename})
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	if names := filenames(nzb); strings.Join(names, ",") != "b.rar,c.rar,a.par2" {
+		t.Errorf("Expected files sorted by filename with par2 last, got %v", names)
+	}
+
+	if nzb.Files[0].Segments[0].Number != 1 {
+		t.Error("Expected segments to be sorted by number")
+	}
+
+	nzb, err = ParseStringWithOptions(unnumberedNZB, ParseOptions{SortBy: SortByNone})
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	if names := filenames(nzb); strings.Join(names, ",") != "c.rar,a.par2,b.rar" {
+		t.Errorf("Expected files in input order, got %v", names)
+	}
+
+	if nzb.Files[2].Segments[0].Number != 2 {
+		t.Error("Expected segments in input order")
+	}
+
+	// the default sorts by number
+	nzb, err = ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if names := filenames(nzb); strings.Join(names, ",") != "file1.rar,file2.rar,file3.par2" {
+		t.Errorf("Expected files sorted by number, got %v", names)
+	}
+}
+
+func TestNoSortRoundTrip(t *testing.T) {
+	// write an nzb with files and segments out of order
+	written, err := WriteWithOptions(&Nzb{
+		Comment: "round trip",
+		Meta:    map[string]string{"title": "Round Trip"},
+		Files: []NzbFile{
+			{
+				Poster:   "test@example.com",
+				Date:     1234567890,
+				Subject:  "[2/2] Round Trip - \"b.rar\" yEnc (1/2)",
+				Groups:   []string{"alt.test"},
+				Bytes:    300,
+				Segments: []NzbSegment{{Bytes: 200, Number: 2, ID: "b-2"}, {Bytes: 100, Number: 1, ID: "b-1"}},
+			},
+			{
+				Poster:   "test@example.com",
+				Date:     1234567890,
+				Subject:  "[1/2] Round Trip - \"a.rar\" yEnc (1/1)",
+				Groups:   []string{"alt.test"},
+				Bytes:    100,
+				Segments: []NzbSegment{{Bytes: 100, Number: 1, ID: "a-1"}},
+			},
+		},
+	}, WriteOptions{KeepSegmentOrder: true})
+	if err != nil {
+		t.Fatalf("WriteWithOptions failed: %v", err)
+	}
+
+	nzb, err := ParseBytesWithOptions(written, ParseOptions{RemoveDuplicates: true, NoSort: true})
+	if err != nil {
+		t.Fatalf("ParseBytesWithOptions failed: %v", err)
+	}
+
+	// the nzb is still scanned
+	if nzb.Files[0].Number != 2 || nzb.Files[0].Filename != "b.rar" || nzb.Bytes != 400 {
+		t.Errorf("Expected the unsorted nzb to be scanned, got %+v", nzb.Files[0])
+	}
+
+	rewritten, err := WriteWithOptions(nzb, WriteOptions{KeepSegmentOrder: true})
+	if err != nil {
+		t.Fatalf("WriteWithOptions failed: %v", err)
+	}
+
+	if !bytes.Equal(written, rewritten) {
+		t.Errorf("Expected the input order to be reproduced, got:\n%s\nwant:\n%s", rewritten, written)
+	}
+}
+
+func TestCommentRoundTrip(t *testing.T) {
+	for _, comment := range []string{"", "comment", "multi word comment"} {
+		nzb := &Nzb{
+			Comment: comment,
+			Files: []NzbFile{
+				{
+					Subject:  "Test Subject",
+					Groups:   []string{"alt.test"},
+					Segments: []NzbSegment{{Bytes: 100, Number: 1, ID: "a-1"}},
+				},
+			},
+		}
+
+		output, err := Write(nzb)
+		if err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		parsed, err := Parse(bytes.NewReader(output))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+
+		if parsed.Comment != comment {
+			t.Errorf("Expected comment %q after the round trip, got %q", comment, parsed.Comment)
+		}
+	}
+
+	// surrounding whitespace of the xml comment is trimmed
+	nzb, err := ParseString(`<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb"><!--   padded
+  --><file subject="a"><groups><group>alt.test</group></groups><segments><segment bytes="1" number="1">a@b</segment></segments></file></nzb>`)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if nzb.Comment != "padded" {
+		t.Errorf("Expected comment %q, got %q", "padded", nzb.Comment)
+	}
+}
+
+func TestHeadComments(t *testing.T) {
+	input := `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <!-- top -->
+  <head>
+    <!-- generated by tool 1.0 -->
+    <meta type="title">Release</meta>
+    <!--source: indexer-->
+    <meta type="category">TV</meta>
+  </head>
+  <file poster="poster" date="1" subject="&quot;a.txt&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a@test</segment></segments>
+  </file>
+</nzb>`
+
+	nzb, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	expected := []string{"generated by tool 1.0", "source: indexer"}
+	if !reflect.DeepEqual(nzb.HeadComments, expected) {
+		t.Errorf("Expected head comments %q, got %q", expected, nzb.HeadComments)
+	}
+
+	if nzb.Comment != "top" || nzb.Meta["title"] != "Release" || nzb.Meta["category"] != "TV" {
+		t.Errorf("Unexpected comment %q or meta %v", nzb.Comment, nzb.Meta)
+	}
+
+	output, err := WriteString(nzb)
+	if err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+
+	if !strings.Contains(output, "<head>\n    <!-- generated by tool 1.0 -->\n    <!-- source: indexer -->\n    <meta type=\"category\">TV</meta>") {
+		t.Errorf("Expected the head comments to be written before the meta data:\n%s", output)
+	}
+
+	parsed, err := ParseString(output)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(parsed.HeadComments, expected) {
+		t.Errorf("Expected head comments %q after the round trip, got %q", expected, parsed.HeadComments)
+	}
+}
+
 func TestNzbFilesSorting(t *testing.T) {
 	files := NzbFiles{
 		{Number: 3},
@@ -521,6 +2161,43 @@ func TestNzbFilesSorting(t *testing.T) {
 	}
 }
 
+func TestNzbFilesSortHelpers(t *testing.T) {
+	files := NzbFiles{
+		{Number: 1, Filename: "release.vol00+01.par2", Date: 30, Bytes: 50},
+		{Number: 2, Filename: "release.part02.rar", Date: 10, Bytes: 300},
+		{Number: 3, Filename: "release.par2", Date: 20, Bytes: 10},
+		{Number: 4, Filename: "release.part01.rar", Date: 10, Bytes: 300},
+	}
+
+	numbers := func(files NzbFiles) []int {
+		var n []int
+		for _, file := range files {
+			n = append(n, file.Number)
+		}
+
+		return n
+	}
+
+	cases := []struct {
+		name     string
+		sort     func(NzbFiles)
+		expected []int
+	}{
+		{"filename", NzbFiles.SortByFilename, []int{4, 2, 3, 1}},
+		{"date", NzbFiles.SortByDate, []int{2, 4, 3, 1}},
+		{"size", NzbFiles.SortBySize, []int{3, 1, 2, 4}},
+	}
+
+	for _, c := range cases {
+		sorted := append(NzbFiles(nil), files...)
+		c.sort(sorted)
+
+		if got := numbers(sorted); !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, got)
+		}
+	}
+}
+
 func TestNzbSegmentsSorting(t *testing.T) {
 	segments := NzbSegments{
 		{Number: 3},
@@ -635,6 +2312,254 @@ func TestParseWithReaderError(t *testing.T) {
 	}
 }
 
+func TestParseVerbose(t *testing.T) {
+	// a well formed nzb has no warnings
+	nzb, warnings, err := ParseVerbose(strings.NewReader(streamTestNZB), ParseOptions{})
+	if err != nil {
+		t.Fatalf("ParseVerbose failed: %v", err)
+	}
+
+	if len(nzb.Files) == 0 || len(warnings) != 0 {
+		t.Errorf("Expected files without warnings, got %d files and %q", len(nzb.Files), warnings)
+	}
+
+	input := `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="poster" date="1" subject="&quot;empty.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments></segments>
+  </file>
+  <file poster="poster" date="1" subject="(1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a@test</segment></segments>
+  </file>
+  <file poster="poster" date="1" subject="&quot;broken.rar&quot; yEnc (1/3)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="0" number="1">b1@test</segment>
+      <segment bytes="100" number="2">b2@test</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	_, warnings, err = ParseVerbose(strings.NewReader(input), ParseOptions{NoSort: true})
+	if err != nil {
+		t.Fatalf("ParseVerbose failed: %v", err)
+	}
+
+	expected := []string{
+		`file "\"empty.rar\" yEnc (1/1)": no segments`,
+		`file "(1/1)": no filename in subject`,
+		`file "\"broken.rar\" yEnc (1/3)": 2 of 3 segments`,
+		`file "\"broken.rar\" yEnc (1/3)": segment 1: invalid byte count 0`,
+	}
+
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("Expected warnings:\n%q\ngot:\n%q", expected, warnings)
+	}
+
+	// errors are still returned
+	if _, _, err := ParseVerbose(strings.NewReader("garbage"), ParseOptions{}); err == nil {
+		t.Error("Expected error for invalid input, got nil")
+	}
+}
+
+func TestValidateMessageIDs(t *testing.T) {
+	input := `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="poster" date="1" subject="&quot;file.rar&quot; yEnc (1/4)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="1">a-1@test</segment>
+      <segment bytes="100" number="2">a&lt;2@test</segment>
+      <segment bytes="100" number="3"></segment>
+      <segment bytes="100" number="4">&lt;a-4@test&gt;</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	// the segments are kept by default
+	nzb, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if nzb.Files[0].Segments.Len() != 4 {
+		t.Errorf("Expected all segments without validation, got %+v", nzb.Files[0].Segments)
+	}
+
+	nzb, warnings, err := ParseVerbose(strings.NewReader(input), ParseOptions{ValidateMessageIDs: true})
+	if err != nil {
+		t.Fatalf("ParseVerbose failed: %v", err)
+	}
+
+	var ids []string
+	for _, segment := range nzb.Files[0].Segments {
+		ids = append(ids, segment.ID)
+	}
+
+	if expected := []string{"a-1@test", "a-4@test"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected the segments %q, got %q", expected, ids)
+	}
+
+	expected := []string{
+		`file "\"file.rar\" yEnc (1/4)": segment 2: invalid message-id "a<2@test" dropped`,
+		`file "\"file.rar\" yEnc (1/4)": segment 3: invalid message-id "" dropped`,
+		`file "\"file.rar\" yEnc (1/4)": 2 of 4 segments`,
+	}
+
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("Expected warnings:\n%q\ngot:\n%q", expected, warnings)
+	}
+}
+
+func TestSkipMalformedFiles(t *testing.T) {
+	input := `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="poster" date="1" subject="&quot;good1.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a@test</segment></segments>
+  </file>
+  <file poster="poster" date="1" subject="&quot;bad.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="abc" number="1">b@test</segment></segments>
+  </file>
+  <file poster="poster" date="1" subject="&quot;good2.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">c@test</segment></segments>
+  </file>
+</nzb>`
+
+	// strict by default
+	if _, err := ParseWithOptions(strings.NewReader(input), ParseOptions{}); !errors.Is(err, ErrInvalidNZB) {
+		t.Fatalf("Expected ErrInvalidNZB, got %v", err)
+	}
+
+	nzb, warnings, err := ParseVerbose(strings.NewReader(input), ParseOptions{SkipMalformedFiles: true})
+	if err != nil {
+		t.Fatalf("ParseVerbose failed: %v", err)
+	}
+
+	if len(nzb.Files) != 2 || nzb.Files[0].Filename != "good1.rar" || nzb.Files[1].Filename != "good2.rar" {
+		t.Errorf("Expected the good files, got %+v", nzb.Files)
+	}
+
+	if len(nzb.Files[1].Segments) != 1 || nzb.Files[1].Segments[0].ID != "c@test" {
+		t.Errorf("Expected the segments of the file after the skipped one, got %+v", nzb.Files[1].Segments)
+	}
+
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], `file "\"bad.rar\" yEnc (1/1)": skipped: `) {
+		t.Errorf("Expected a warning about the skipped file, got %q", warnings)
+	}
+
+	// well formed files decode the same
+	expected, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	nzb, err = ParseWithOptions(strings.NewReader(streamTestNZB), ParseOptions{RemoveDuplicates: true, SkipMalformedFiles: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(nzb, expected) {
+		t.Errorf("Expected the same nzb with SkipMalformedFiles, got %+v", nzb)
+	}
+
+	// broken xml can't be skipped
+	if _, err := ParseWithOptions(strings.NewReader(input[:strings.Index(input, "c@test")]), ParseOptions{SkipMalformedFiles: true}); !errors.Is(err, ErrInvalidNZB) {
+		t.Errorf("Expected ErrInvalidNZB for broken xml, got %v", err)
+	}
+}
+
+func TestParseInvalidDate(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="poster" date="invalid" subject="&quot;a.txt&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a@test</segment></segments>
+  </file>
+  <file poster="poster" subject="&quot;b.txt&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">b@test</segment></segments>
+  </file>
+  <file poster="poster" date=" 1706140800 " subject="&quot;c.txt&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">c@test</segment></segments>
+  </file>
+</nzb>`
+
+	nzb, err := ParseString(input)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	for i, want := range []int{0, 0, 1706140800} {
+		if got := nzb.Files[i].Date; got != want {
+			t.Errorf("%s: expected date %d, got %d", nzb.Files[i].Filename, want, got)
+		}
+	}
+}
+
+func TestParseTextualDates(t *testing.T) {
+	const epoch = 1234567890 // 2009-02-13 23:31:30 UTC
+
+	for _, date := range []string{
+		"1234567890",
+		"1234567890123", // milliseconds
+		"Fri, 13 Feb 2009 23:31:30 UTC",
+		"Fri, 13 Feb 2009 23:31:30 +0000",
+		"Sat, 14 Feb 2009 00:31:30 +0100",
+		"13 Feb 09 23:31 UTC",
+		"2009-02-13T23:31:30Z",
+		"2009-02-14T01:31:30+02:00",
+	} {
+		input := `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="poster" date="` + date + `" subject="&quot;a.txt&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">a@test</segment></segments>
+  </file>
+</nzb>`
+
+		nzb, err := ParseString(input)
+		if err != nil {
+			t.Fatalf("%q: ParseString failed: %v", date, err)
+		}
+
+		file := nzb.Files[0]
+
+		// RFC822 has no seconds
+		want := epoch
+		if date == "13 Feb 09 23:31 UTC" {
+			want = epoch - 30
+		}
+
+		if file.Date != want || file.DateRaw != date {
+			t.Errorf("%q: expected date %d, got %d (raw %q)", date, want, file.Date, file.DateRaw)
+		}
+
+		// the original representation is written back
+		output, err := WriteString(nzb)
+		if err != nil {
+			t.Fatalf("%q: WriteString failed: %v", date, err)
+		}
+
+		if !strings.Contains(output, `<file poster="poster" date="`+date+`"`) {
+			t.Errorf("%q: expected the raw date to be written:\n%s", date, output)
+		}
+
+		// unless the date was changed
+		nzb.Files[0].Date = 42
+
+		output, err = WriteString(nzb)
+		if err != nil {
+			t.Fatalf("%q: WriteString failed: %v", date, err)
+		}
+
+		if !strings.Contains(output, `date="42"`) {
+			t.Errorf("%q: expected the changed date to be written:\n%s", date, output)
+		}
+	}
+}
+
 func TestWriteWithEmptyComment(t *testing.T) {
 	// Test Write with empty comment
 	nzb := &Nzb{
@@ -724,3 +2649,264 @@ func TestSegmentIDUnescaping(t *testing.T) {
 		}
 	}
 }
+
+func TestMultilineSegmentIDs(t *testing.T) {
+	prettyNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Test - &quot;a.rar&quot; yEnc (1/2)">
+    <groups>
+      <group>alt.test</group>
+    </groups>
+    <segments>
+      <segment bytes="100" number="1">
+        part1@example.com
+      </segment>
+      <segment bytes="100" number="2">part2
+        @example.com</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	nzb, err := ParseString(prettyNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	segments := nzb.Files[0].Segments
+	if segments[0].ID != "part1@example.com" || segments[1].ID != "part2@example.com" {
+		t.Errorf("Unexpected cleaned ids %q and %q", segments[0].ID, segments[1].ID)
+	}
+
+	// the same applies when scanning a manually built nzb
+	nzb = &Nzb{Files: []NzbFile{{Segments: []NzbSegment{{Number: 1, ID: "\t<part1@\r\nexample.com>\n"}}}}}
+	ScanNzbFile(nzb)
+
+	if id := nzb.Files[0].Segments[0].ID; id != "part1@example.com" {
+		t.Errorf("Unexpected cleaned id %q", id)
+	}
+
+	// the whitespace is removed with any options, only the angle brackets are optional
+	nzb, err = ParseWithOptions(strings.NewReader(prettyNZB), ParseOptions{RemoveDuplicates: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions failed: %v", err)
+	}
+
+	segments = nzb.Files[0].Segments
+	if segments[0].ID != "part1@example.com" || segments[1].ID != "part2@example.com" {
+		t.Errorf("Unexpected cleaned ids with options %q and %q", segments[0].ID, segments[1].ID)
+	}
+}
+
+func TestCDATASegmentIDs(t *testing.T) {
+	cdataNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="[1/1] Test - &quot;a.rar&quot; yEnc (1/3)">
+    <groups>
+      <group>alt.test</group>
+    </groups>
+    <segments>
+      <segment bytes="100" number="1"><![CDATA[part1@example.com]]></segment>
+      <segment bytes="100" number="2"> <![CDATA[<part2&amp;x@example.com>]]> </segment>
+      <segment bytes="100" number="3">part3&amp;x@example.com</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	nzb, err := ParseString(cdataNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	segments := nzb.Files[0].Segments
+	if segments[0].ID != "part1@example.com" {
+		t.Errorf("Expected plain id for a CDATA segment, got %q", segments[0].ID)
+	}
+
+	// CDATA content is not unescaped
+	if segments[1].ID != "part2&amp;x@example.com" {
+		t.Errorf("Expected CDATA content to be kept as it is, got %q", segments[1].ID)
+	}
+
+	if segments[2].ID != "part3&x@example.com" {
+		t.Errorf("Expected escaped content to be unescaped, got %q", segments[2].ID)
+	}
+}
+
+func TestNormalizeMessageIDs(t *testing.T) {
+	// the same segments once with and once without angle brackets
+	mixedNZB := Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="Test Subject">
+    <groups>
+      <group>alt.test</group>
+    </groups>
+    <segments>
+      <segment bytes="100" number="1">&lt;part1@example.com&gt;</segment>
+      <segment bytes="100" number="1">part1@example.com</segment>
+      <segment bytes="200" number="2"> &lt;part2@example.com&gt; </segment>
+      <segment bytes="200" number="2">part2@example.com</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	nzb, err := ParseString(mixedNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	segments := nzb.Files[0].Segments
+	if len(segments) != 2 {
+		t.Fatalf("Expected 2 segments after deduplicating normalized ids, got %d: %+v", len(segments), segments)
+	}
+
+	if segments[0].ID != "part1@example.com" || segments[1].ID != "part2@example.com" {
+		t.Errorf("Unexpected normalized ids %q and %q", segments[0].ID, segments[1].ID)
+	}
+
+	// the options normalize like Parse
+	nzb, err = ParseStringWithOptions(mixedNZB, ParseOptions{RemoveDuplicates: true})
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	if len(nzb.Files[0].Segments) != 2 {
+		t.Errorf("Expected 2 segments with the zero options, got %d", len(nzb.Files[0].Segments))
+	}
+
+	// opt out to keep the raw form
+	nzb, err = ParseStringWithOptions(mixedNZB, ParseOptions{RemoveDuplicates: true, KeepRawMessageIDs: true})
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	segments = nzb.Files[0].Segments
+	if len(segments) != 4 {
+		t.Fatalf("Expected 4 segments with raw ids, got %d", len(segments))
+	}
+
+	raw := false
+
+	for _, segment := range segments {
+		if segment.ID == "<part1@example.com>" {
+			raw = true
+		}
+	}
+
+	if !raw {
+		t.Errorf("Expected raw id '<part1@example.com>' to be kept, got %+v", segments)
+	}
+}
+
+// build an nzb with many files for the parallel scan
+func manyFilesNzb(files int) *Nzb {
+	nzb := &Nzb{}
+
+	for i := 1; i <= files; i++ {
+		nzb.Files = append(nzb.Files, NzbFile{
+			Subject: fmt.Sprintf(`[%d/%d] Release.Name.S01E01.1080p.WEB.h264-GROUP - "release.name.part%03d.rar" yEnc (1/3)`, i, files, i),
+			Groups:  []string{"alt.test"},
+			Segments: []NzbSegment{
+				{Bytes: int64(100 + i), Number: 1, ID: fmt.Sprintf("%d-1", i)},
+				{Bytes: int64(200 + i), Number: 2, ID: fmt.Sprintf("%d-2", i)},
+			},
+		})
+	}
+
+	return nzb
+}
+
+func TestParallelScan(t *testing.T) {
+	sequential := manyFilesNzb(500)
+	parallel := manyFilesNzb(500)
+
+	scanNzbFiles(sequential, ParseOptions{})
+	scanNzbFiles(parallel, ParseOptions{Parallel: true})
+
+	if !reflect.DeepEqual(sequential, parallel) {
+		t.Error("Expected the parallel scan to produce the same result as the sequential scan")
+	}
+
+	if parallel.TotalFiles != 500 || parallel.Segments != 1000 || parallel.Files[499].Number != 500 {
+		t.Errorf("Unexpected scan results: %d files, %d segments", parallel.TotalFiles, parallel.Segments)
+	}
+
+	data, err := Write(manyFilesNzb(50))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	expected, err := ParseBytes(data)
+	if err != nil {
+		t.Fatalf("ParseBytes failed: %v", err)
+	}
+
+	nzb, err := ParseBytesWithOptions(data, ParseOptions{RemoveDuplicates: true, Parallel: true})
+	if err != nil {
+		t.Fatalf("ParseBytesWithOptions failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(expected, nzb) {
+		t.Error("Expected the parallel parse to produce the same result as the sequential parse")
+	}
+}
+
+func BenchmarkScanNzb(b *testing.B) {
+	for _, parallel := range []bool{false, true} {
+		b.Run(fmt.Sprintf("parallel=%v", parallel), func(b *testing.B) {
+			nzb := manyFilesNzb(10000)
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				scanNzbFiles(nzb, ParseOptions{Parallel: parallel})
+			}
+		})
+	}
+}
+
+func TestParseValidator(t *testing.T) {
+	input := `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <head>
+    <meta type="title">Release</meta>
+  </head>
+  <file poster="poster" date="1" subject="[1/1] &quot;file.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="1">a-1@test</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	errNoCategory := errors.New("missing category meta")
+
+	var validated *Nzb
+
+	opts := ParseOptions{
+		Validator: func(nzb *Nzb) error {
+			validated = nzb
+
+			if _, ok := nzb.GetMeta("category"); !ok {
+				return errNoCategory
+			}
+
+			return nil
+		},
+	}
+
+	nzb, err := ParseWithOptions(strings.NewReader(input), opts)
+	if !errors.Is(err, ErrRejected) || !errors.Is(err, errNoCategory) {
+		t.Fatalf("Expected the validator error wrapped in ErrRejected, got %v", err)
+	}
+
+	if nzb != nil {
+		t.Errorf("Expected no nzb for a rejected nzb, got %+v", nzb)
+	}
+
+	// the validator sees the scanned nzb
+	if validated == nil || validated.Files[0].Filename != "file.rar" || validated.Bytes != 100 {
+		t.Errorf("Expected the validator to get the scanned nzb, got %+v", validated)
+	}
+
+	input = strings.Replace(input, "</head>", `<meta type="category">TV</meta></head>`, 1)
+
+	if _, err := ParseWithOptions(strings.NewReader(input), opts); err != nil {
+		t.Errorf("Expected the nzb with category to pass the validator, got %v", err)
+	}
+}
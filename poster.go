@@ -0,0 +1,46 @@
+package nzbparser
+
+import (
+	"sort"
+	"strings"
+)
+
+// returns the lowercased domain of the poster address (test@example.com becomes example.com)
+// posters in the "Name <user@example.com>" form are supported, an empty string is returned if there is no domain
+func (f *NzbFile) PosterDomain() string {
+	idx := strings.LastIndex(f.Poster, "@")
+	if idx == -1 {
+		return ""
+	}
+
+	domain := f.Poster[idx+1:]
+	if end := strings.IndexAny(domain, "> \t"); end != -1 {
+		domain = domain[:end]
+	}
+
+	return strings.ToLower(domain)
+}
+
+// returns the sorted distinct posters of all files
+// surrounding whitespace is trimmed and empty posters are skipped
+func (n *Nzb) Posters() []string {
+	seen := make(map[string]struct{})
+
+	var posters []string
+
+	for _, file := range n.Files {
+		poster := strings.TrimSpace(file.Poster)
+		if poster == "" {
+			continue
+		}
+
+		if _, ok := seen[poster]; !ok {
+			seen[poster] = struct{}{}
+			posters = append(posters, poster)
+		}
+	}
+
+	sort.Strings(posters)
+
+	return posters
+}
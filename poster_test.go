@@ -0,0 +1,44 @@
+package nzbparser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPosterDomain(t *testing.T) {
+	cases := map[string]string{
+		"test@example.com":                 "example.com",
+		"Test@Example.COM":                 "example.com",
+		"John Doe <john@news.example.org>": "news.example.org",
+		"no domain":                        "",
+		"":                                 "",
+		"trailing@":                        "",
+	}
+
+	for poster, expected := range cases {
+		file := NzbFile{Poster: poster}
+		if got := file.PosterDomain(); got != expected {
+			t.Errorf("%q: expected domain %q, got %q", poster, expected, got)
+		}
+	}
+}
+
+func TestPosters(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Poster: "b@example.com"},
+			{Poster: " a@example.com "},
+			{Poster: "b@example.com"},
+			{},
+		},
+	}
+
+	expected := []string{"a@example.com", "b@example.com"}
+	if posters := nzb.Posters(); !reflect.DeepEqual(posters, expected) {
+		t.Errorf("Expected posters %v, got %v", expected, posters)
+	}
+
+	if posters := (&Nzb{}).Posters(); len(posters) != 0 {
+		t.Errorf("Expected no posters for an empty nzb, got %v", posters)
+	}
+}
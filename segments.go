@@ -0,0 +1,218 @@
+package nzbparser
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// message-id of the form local-part@domain of printable ascii characters without angle brackets and spaces
+var messageIDRE = regexp.MustCompile(`^[!-;=?A-~]+@[!-;=?A-~]+$`)
+
+// maximum length of a message-id without the enclosing angle brackets (250 octets including them)
+const maxMessageIDLength = 248
+
+// position of a segment in the files of an nzb
+type segmentPosition struct {
+	file    int
+	segment int
+}
+
+// returns the position of the segment with the message-id in Files[fileIndex].Segments[segIndex]
+// the message-id is normalized like with Parse (whitespace and enclosing angle brackets are removed) but not unescaped
+// the lookups are served by an index built on the first call, which is only valid as long as Files is not changed
+// call RebuildIndex after changing the files, a stale position is detected and the index is rebuilt in that case
+func (n *Nzb) SegmentByID(id string) (fileIndex, segIndex int, ok bool) {
+	c := n.cache()
+
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+
+	id = normalizeSegmentID(id)
+
+	// copies of the nzb share the index, which is rebuilt if it was built for other files
+	if c.segmentIndex == nil || !c.indexed(n.Files) {
+		n.rebuildIndex(c)
+	}
+
+	position, ok := c.segmentIndex[id]
+	if ok && !n.segmentAt(position, id) {
+		n.rebuildIndex(c)
+		position, ok = c.segmentIndex[id]
+	}
+
+	if !ok {
+		return 0, 0, false
+	}
+
+	return position.file, position.segment, true
+}
+
+// rebuild the message-id index used by SegmentByID, required after changing Files
+func (n *Nzb) RebuildIndex() {
+	c := n.cache()
+
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+
+	n.rebuildIndex(c)
+}
+
+// build the message-id index of the cache, the first position of a message-id is kept
+func (n *Nzb) rebuildIndex(c *nzbCache) {
+	c.segmentIndex = make(map[string]segmentPosition)
+	c.indexFiles = n.Files
+
+	for fileIndex := range n.Files {
+		for segIndex, segment := range n.Files[fileIndex].Segments {
+			id := normalizeSegmentID(segment.ID)
+			if _, ok := c.segmentIndex[id]; !ok {
+				c.segmentIndex[id] = segmentPosition{file: fileIndex, segment: segIndex}
+			}
+		}
+	}
+}
+
+// check if the segment index was built for the files
+func (c *nzbCache) indexed(files NzbFiles) bool {
+	return len(c.indexFiles) == len(files) && (len(files) == 0 || &c.indexFiles[0] == &files[0])
+}
+
+// drop the segment index, so it is rebuilt by the next lookup
+func (c *nzbCache) invalidateIndex() {
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+
+	c.segmentIndex = nil
+	c.indexFiles = nil
+}
+
+// check if the segment with the message-id is still at the position
+func (n *Nzb) segmentAt(position segmentPosition, id string) bool {
+	if position.file >= len(n.Files) || position.segment >= len(n.Files[position.file].Segments) {
+		return false
+	}
+
+	return normalizeSegmentID(n.Files[position.file].Segments[position.segment].ID) == id
+}
+
+// iterates over all segments of all files together with the index of their file in Files
+// follows the range-over-func convention, so it can be used as: for id, segment := range n.AllSegments
+// the iteration stops as soon as yield returns false
+func (n *Nzb) AllSegments(yield func(fileIndex int, seg NzbSegment) bool) {
+	for id := range n.Files {
+		for _, segment := range n.Files[id].Segments {
+			if !yield(id, segment) {
+				return
+			}
+		}
+	}
+}
+
+// returns the segment message-ids contained in more than one file mapped to the subjects of these files in file order
+// the nzb is not changed, duplicates within a single file are removed by MakeUnique instead
+func (n *Nzb) DuplicateSegmentIDs() map[string][]string {
+	subjects := make(map[string][]string)
+
+	for id := range n.Files {
+		seen := make(map[string]struct{}, len(n.Files[id].Segments))
+
+		for _, segment := range n.Files[id].Segments {
+			if _, ok := seen[segment.ID]; ok {
+				continue
+			}
+
+			seen[segment.ID] = struct{}{}
+			subjects[segment.ID] = append(subjects[segment.ID], n.Files[id].Subject)
+		}
+	}
+
+	duplicates := make(map[string][]string)
+
+	for id, files := range subjects {
+		if len(files) > 1 {
+			duplicates[id] = files
+		}
+	}
+
+	return duplicates
+}
+
+// remove segments whose message-id was already seen in the nzb, the first copy in file order is kept
+// with caseFold message-ids differing only in case are duplicates
+func removeDuplicateSegmentIDs(nzb *Nzb, caseFold bool) {
+	seen := make(map[string]struct{})
+
+	for id := range nzb.Files {
+		var unique []NzbSegment
+
+		for _, segment := range nzb.Files[id].Segments {
+			key := segmentKey(segment.ID, caseFold)
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				unique = append(unique, segment)
+			}
+		}
+
+		nzb.Files[id].Segments = unique
+	}
+}
+
+// returns the key identifying duplicates of the segment message-id, lowercased with caseFold
+// message-ids are case-sensitive, but some broken reposts change their case
+func segmentKey(id string, caseFold bool) string {
+	if caseFold {
+		return strings.ToLower(id)
+	}
+
+	return id
+}
+
+// returns the message-ids of the segments in segment number order, normalized like with Parse
+// the message-ids are already unescaped, so they are not unescaped again, the segments are sorted on a copy, so the order of Segments is kept
+func (f *NzbFile) MessageIDs() []string {
+	segments := append(NzbSegments(nil), f.Segments...)
+	sort.Stable(segments)
+
+	ids := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		ids = append(ids, normalizeSegmentID(segment.ID))
+	}
+
+	return ids
+}
+
+// returns the message-ids of all files in file order, each file in segment number order as with NzbFile.MessageIDs
+func (n *Nzb) MessageIDs() []string {
+	var ids []string
+
+	for id := range n.Files {
+		ids = append(ids, n.Files[id].MessageIDs()...)
+	}
+
+	return ids
+}
+
+// replace the message-id of every segment of all files with the one returned by fn
+// numbers and bytes of the segments are kept, duplicate message-ids returned by fn are not removed
+// the index of SegmentByID is reset, so it is built again for the new message-ids
+func (n *Nzb) RewriteSegmentIDs(fn func(old string) string) {
+	for fileIndex := range n.Files {
+		for segIndex := range n.Files[fileIndex].Segments {
+			segment := &n.Files[fileIndex].Segments[segIndex]
+			segment.ID = fn(segment.ID)
+		}
+	}
+
+	n.cache().invalidateIndex()
+}
+
+// check if the message-id has the shape of a usenet message-id: local-part@domain without spaces, at most 250 characters
+// a single pair of enclosing angle brackets is accepted
+func IsValidMessageID(id string) bool {
+	if len(id) > 1 && id[0] == '<' && id[len(id)-1] == '>' {
+		id = id[1 : len(id)-1]
+	}
+
+	return len(id) <= maxMessageIDLength && messageIDRE.MatchString(id)
+}
@@ -0,0 +1,311 @@
+package nzbparser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAllSegments(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Segments: []NzbSegment{{Number: 1, Bytes: 100, ID: "a-1"}, {Number: 2, Bytes: 200, ID: "a-2"}}},
+			{},
+			{Segments: []NzbSegment{{Number: 1, Bytes: 300, ID: "c-1"}}},
+		},
+	}
+
+	var ids []string
+
+	var files []int
+
+	for id, segment := range nzb.AllSegments {
+		files = append(files, id)
+		ids = append(ids, segment.ID)
+	}
+
+	if len(ids) != 3 || ids[0] != "a-1" || ids[1] != "a-2" || ids[2] != "c-1" {
+		t.Errorf("Unexpected segments %v", ids)
+	}
+
+	if len(files) != 3 || files[0] != 0 || files[1] != 0 || files[2] != 2 {
+		t.Errorf("Unexpected file indices %v", files)
+	}
+
+	// stop early
+	count := 0
+	for range nzb.AllSegments {
+		count++
+		if count == 2 {
+			break
+		}
+	}
+
+	if count != 2 {
+		t.Errorf("Expected iteration to stop after 2 segments, got %d", count)
+	}
+
+	calls := 0
+	nzb.AllSegments(func(int, NzbSegment) bool {
+		calls++
+		return false
+	})
+
+	if calls != 1 {
+		t.Errorf("Expected yield to be called once when returning false, got %d", calls)
+	}
+}
+
+const repostNZB = Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="test@example.com" date="1234567890" subject="[1/2] Test - &quot;a.rar&quot; yEnc (1/2)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="1">shared-1</segment>
+      <segment bytes="100" number="2">a-2</segment>
+    </segments>
+  </file>
+  <file poster="test@example.com" date="1234567890" subject="[2/2] Test - &quot;b.rar&quot; yEnc (1/2)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="1">shared-1</segment>
+      <segment bytes="100" number="2">b-2</segment>
+    </segments>
+  </file>
+</nzb>`
+
+func TestDuplicateSegmentIDs(t *testing.T) {
+	nzb, err := ParseString(repostNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	duplicates := nzb.DuplicateSegmentIDs()
+
+	expected := map[string][]string{
+		"shared-1": {`[1/2] Test - "a.rar" yEnc (1/2)`, `[2/2] Test - "b.rar" yEnc (1/2)`},
+	}
+	if !reflect.DeepEqual(duplicates, expected) {
+		t.Errorf("Expected duplicates %v, got %v", expected, duplicates)
+	}
+
+	// reporting does not change the nzb
+	if nzb.Files[1].Segments.Len() != 2 {
+		t.Errorf("Expected the nzb to be untouched, got %d segments", nzb.Files[1].Segments.Len())
+	}
+
+	nzb, err = ParseStringWithOptions(repostNZB, ParseOptions{RemoveDuplicates: true, GlobalDedup: true})
+	if err != nil {
+		t.Fatalf("ParseStringWithOptions failed: %v", err)
+	}
+
+	if nzb.Files[0].Segments.Len() != 2 || nzb.Files[1].Segments.Len() != 1 || nzb.Files[1].Segments[0].ID != "b-2" {
+		t.Errorf("Expected the copy of the second file to be removed, got %+v", nzb.Files)
+	}
+
+	if nzb.Segments != 3 {
+		t.Errorf("Expected 3 segments after global dedup, got %d", nzb.Segments)
+	}
+
+	if duplicates := nzb.DuplicateSegmentIDs(); len(duplicates) != 0 {
+		t.Errorf("Expected no duplicates after global dedup, got %v", duplicates)
+	}
+}
+
+func TestSegmentByID(t *testing.T) {
+	nzb, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	// files are sorted by number: file1.rar, file2.rar, file3.par2
+	fileIndex, segIndex, ok := nzb.SegmentByID("seg-2-2")
+	if !ok || fileIndex != 1 || segIndex != 1 {
+		t.Errorf("Expected seg-2-2 at 1/1, got %d/%d %v", fileIndex, segIndex, ok)
+	}
+
+	// message-ids are normalized like with Parse
+	fileIndex, segIndex, ok = nzb.SegmentByID(" <seg-3-1> ")
+	if !ok || fileIndex != 2 || segIndex != 0 {
+		t.Errorf("Expected seg-3-1 at 2/0, got %d/%d %v", fileIndex, segIndex, ok)
+	}
+
+	if _, _, ok := nzb.SegmentByID("missing"); ok {
+		t.Error("Expected no position for an unknown message-id")
+	}
+
+	// stale positions are detected after changing the files
+	nzb.RemovePar2()
+	nzb.Files[0], nzb.Files[1] = nzb.Files[1], nzb.Files[0]
+
+	if _, _, ok := nzb.SegmentByID("seg-3-1"); ok {
+		t.Error("Expected no position for a removed segment")
+	}
+
+	fileIndex, segIndex, ok = nzb.SegmentByID("seg-2-2")
+	if !ok || fileIndex != 0 || segIndex != 1 {
+		t.Errorf("Expected seg-2-2 at 0/1 after reordering, got %d/%d %v", fileIndex, segIndex, ok)
+	}
+
+	// new segments are found after rebuilding the index
+	nzb.Files[0].Segments = append(nzb.Files[0].Segments, NzbSegment{Number: 3, Bytes: 100, ID: "seg-2-3"})
+	nzb.RebuildIndex()
+
+	fileIndex, segIndex, ok = nzb.SegmentByID("seg-2-3")
+	if !ok || fileIndex != 0 || segIndex != 2 {
+		t.Errorf("Expected seg-2-3 at 0/2 after rebuilding, got %d/%d %v", fileIndex, segIndex, ok)
+	}
+
+	// the parsed message-id is looked up as it is, without unescaping it again
+	nzb.Files[0].Segments = append(nzb.Files[0].Segments, NzbSegment{Number: 4, Bytes: 100, ID: "b&amp;c@host"})
+	nzb.RebuildIndex()
+
+	fileIndex, segIndex, ok = nzb.SegmentByID("b&amp;c@host")
+	if !ok || fileIndex != 0 || segIndex != 3 {
+		t.Errorf("Expected b&amp;c@host at 0/3, got %d/%d %v", fileIndex, segIndex, ok)
+	}
+
+	if _, _, ok := nzb.SegmentByID("b&c@host"); ok {
+		t.Error("Expected no position for a different message-id")
+	}
+}
+
+func TestSegmentByIDCopy(t *testing.T) {
+	nzb, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if _, _, ok := nzb.SegmentByID("seg-1-1"); !ok {
+		t.Fatal("Expected a position for seg-1-1")
+	}
+
+	// a copy of the nzb shares the index, which is rebuilt for the files of the copy
+	copied := *nzb
+	copied.Files = NzbFiles{nzb.Files[2], nzb.Files[0]}
+
+	fileIndex, segIndex, ok := copied.SegmentByID("seg-1-1")
+	if !ok || fileIndex != 1 || segIndex != 0 {
+		t.Errorf("Expected seg-1-1 at 1/0 in the copy, got %d/%d %v", fileIndex, segIndex, ok)
+	}
+
+	fileIndex, segIndex, ok = nzb.SegmentByID("seg-2-2")
+	if !ok || fileIndex != 1 || segIndex != 1 {
+		t.Errorf("Expected seg-2-2 at 1/1 in the original, got %d/%d %v", fileIndex, segIndex, ok)
+	}
+
+	if _, _, ok := copied.SegmentByID("seg-2-2"); ok {
+		t.Error("Expected no position for a segment missing in the copy")
+	}
+
+	copied.SetMeta("title", "copy")
+	if title, _ := copied.GetMeta("title"); title != "copy" {
+		t.Errorf("Expected the title of the copy, got %q", title)
+	}
+}
+
+func TestMessageIDs(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Segments: NzbSegments{{Number: 3, ID: "<a-3@test>"}, {Number: 1, ID: " a-1@test "}, {Number: 2, ID: "a-2@test"}}},
+			{},
+			{Segments: NzbSegments{{Number: 5, ID: "b-5@test"}, {Number: 2, ID: "b-2@test"}}},
+		},
+	}
+
+	expected := []string{"a-1@test", "a-2@test", "a-3@test"}
+	if ids := nzb.Files[0].MessageIDs(); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected message-ids %v, got %v", expected, ids)
+	}
+
+	// the segments are not reordered
+	if nzb.Files[0].Segments[0].Number != 3 || nzb.Files[0].Segments[0].ID != "<a-3@test>" {
+		t.Errorf("Expected the segments to be unchanged, got %+v", nzb.Files[0].Segments)
+	}
+
+	expected = []string{"a-1@test", "a-2@test", "a-3@test", "b-2@test", "b-5@test"}
+	if ids := nzb.MessageIDs(); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected message-ids %v, got %v", expected, ids)
+	}
+
+	if ids := (&NzbFile{}).MessageIDs(); len(ids) != 0 {
+		t.Errorf("Expected no message-ids, got %v", ids)
+	}
+
+	// parsed message-ids are not unescaped a second time
+	parsed, err := ParseString(`<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="poster" date="1" subject="&quot;file.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="1">b&amp;amp;c@host</segment></segments>
+  </file>
+</nzb>`)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if ids := parsed.Files[0].MessageIDs(); !reflect.DeepEqual(ids, []string{"b&amp;c@host"}) {
+		t.Errorf("Expected the parsed message-id, got %v", ids)
+	}
+}
+
+func TestRewriteSegmentIDs(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Segments: NzbSegments{{Bytes: 100, Number: 1, ID: "a-1@test"}, {Bytes: 200, Number: 2, ID: "a-2@test"}}},
+			{Segments: NzbSegments{{Bytes: 300, Number: 1, ID: "b-1@test"}}},
+		},
+	}
+
+	// the index of the old message-ids is dropped
+	if _, _, ok := nzb.SegmentByID("a-1@test"); !ok {
+		t.Fatal("Expected the segment to be found before the rewrite")
+	}
+
+	nzb.RewriteSegmentIDs(func(old string) string { return "new-" + old })
+
+	expected := []NzbFile{
+		{Segments: NzbSegments{{Bytes: 100, Number: 1, ID: "new-a-1@test"}, {Bytes: 200, Number: 2, ID: "new-a-2@test"}}},
+		{Segments: NzbSegments{{Bytes: 300, Number: 1, ID: "new-b-1@test"}}},
+	}
+
+	if !reflect.DeepEqual([]NzbFile(nzb.Files), expected) {
+		t.Errorf("Expected the rewritten segments %+v, got %+v", expected, nzb.Files)
+	}
+
+	if fileIndex, segIndex, ok := nzb.SegmentByID("new-b-1@test"); !ok || fileIndex != 1 || segIndex != 0 {
+		t.Errorf("Expected to find the new message-id at 1/0, got %d/%d %v", fileIndex, segIndex, ok)
+	}
+
+	if _, _, ok := nzb.SegmentByID("a-1@test"); ok {
+		t.Error("Expected the old message-id to be gone")
+	}
+
+	// duplicate message-ids are kept
+	nzb.RewriteSegmentIDs(func(string) string { return "same@test" })
+
+	if nzb.Files.Len() != 2 || nzb.Files[0].Segments.Len() != 2 || nzb.Files[0].Segments[1].ID != "same@test" {
+		t.Errorf("Expected all segments with the same message-id, got %+v", nzb.Files)
+	}
+}
+
+func TestIsValidMessageID(t *testing.T) {
+	for id, valid := range map[string]bool{
+		"part1of10.abc123@news.example.com":   true,
+		"<part1of10.abc123@news.example.com>": true,
+		"a$b+c=d@[127.0.0.1]":                 true,
+		"":                                    false,
+		"<>":                                  false,
+		"no-at-sign":                          false,
+		"a b@example.com":                     false,
+		"a@exa mple.com":                      false,
+		"a@b@example.com":                     false,
+		"@example.com":                        false,
+		"a@":                                  false,
+		"<a@example.com":                      false,
+		"a\x00@example.com":                   false,
+		strings.Repeat("a", 240) + "@example.com": false,
+	} {
+		if got := IsValidMessageID(id); got != valid {
+			t.Errorf("%q: expected %v, got %v", id, valid, got)
+		}
+	}
+}
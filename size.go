@@ -0,0 +1,163 @@
+package nzbparser
+
+import (
+	"fmt"
+	"math"
+)
+
+// overhead of the yEnc encoding (escaping, line breaks, =ybegin/=yend lines) relative to the decoded payload
+// used by EstimatedPayloadBytes, may be tuned by callers that know their posting tools better
+var YencOverheadRatio float64 = 0.02
+
+// relative difference between the declared and the summed segment bytes of a file accepted by BytesConsistent
+// the bytes attribute of some posting tools states the decoded size while the segments state the encoded size
+var BytesTolerance float64 = 0.05
+
+// returns an estimate of the decoded payload size of all files
+// the segment bytes reflect the encoded article size, so the yEnc overhead given by YencOverheadRatio is taken off
+// this is only an estimate suited e.g. for progress bars, the real size is only known after decoding
+func (n *Nzb) EstimatedPayloadBytes() int64 {
+	return estimatePayload(n.Bytes)
+}
+
+// returns the estimated decoded size of the given encoded bytes
+func estimatePayload(bytes int64) int64 {
+	if bytes <= 0 {
+		return 0
+	}
+
+	ratio := YencOverheadRatio
+	if ratio < 0 || math.IsNaN(ratio) || math.IsInf(ratio, 0) {
+		ratio = 0
+	}
+
+	return int64(math.Round(float64(bytes) / (1 + ratio)))
+}
+
+// compares the bytes attribute of the file element in the nzb with the sum of the segment bytes to detect truncated files
+// ok is true if the file declares its size and the sum differs by at most BytesTolerance from it
+func (f *NzbFile) BytesConsistent() (expected, actual int64, ok bool) {
+	for _, segment := range f.Segments {
+		actual = actual + segment.Bytes
+	}
+
+	expected = f.DeclaredBytes
+	if expected <= 0 {
+		return expected, actual, false
+	}
+
+	return expected, actual, math.Abs(float64(actual-expected)) <= float64(expected)*BytesTolerance
+}
+
+// returns the estimated size of the file including its missing segments
+// the bytes of the available segments are scaled by the ratio of the total to the available segments, so this is
+// only an estimate assuming segments of the average size, complete files and files without segments return Bytes
+func estimatedTotalBytes(f *NzbFile) int64 {
+	available := f.Segments.Len()
+	if available == 0 || f.TotalSegments <= available {
+		return f.Bytes
+	}
+
+	return int64(math.Round(float64(f.Bytes) * float64(f.TotalSegments) / float64(available)))
+}
+
+// returns true if the segments of the files have any bytes, nzbs whose segments all state 0 bytes can't be scheduled
+// relies on Bytes as computed by ScanNzbFile
+func (n *Nzb) HasPayload() bool {
+	return n.Bytes > 0
+}
+
+// returns the number of articles to download, i.e. the number of available segments
+// relies on Segments as computed by ScanNzbFile
+func (n *Nzb) ArticleCount() int {
+	return n.Segments
+}
+
+// returns the average size of the available segments or 0 if there are none
+// relies on Bytes and Segments as computed by ScanNzbFile
+func (n *Nzb) AverageSegmentBytes() int64 {
+	if n.Segments <= 0 {
+		return 0
+	}
+
+	return n.Bytes / int64(n.Segments)
+}
+
+// returns the bytes of the par2 files relative to the bytes of the content files (e.g. 0.10 for 10% recovery data)
+// returns 0 if there are no par2 or no content files, relies on Filename and Bytes as computed by ScanNzbFile
+func (n *Nzb) RecoveryRatio() float64 {
+	var recovery, content int64
+
+	for id := range n.Files {
+		if n.Files[id].IsPar2() {
+			recovery = recovery + n.Files[id].Bytes
+		} else {
+			content = content + n.Files[id].Bytes
+		}
+	}
+
+	if recovery == 0 || content == 0 {
+		return 0
+	}
+
+	return float64(recovery) / float64(content)
+}
+
+// returns the bytes of the content files, i.e. all files except the par2 files
+// relies on Filename and Bytes as computed by ScanNzbFile
+func (n *Nzb) ContentBytes() int64 {
+	var bytes int64
+
+	for id := range n.Files {
+		if !n.Files[id].IsPar2() {
+			bytes = bytes + n.Files[id].Bytes
+		}
+	}
+
+	return bytes
+}
+
+// returns the number of content files, i.e. all files except the par2 files
+// relies on Filename as computed by ScanNzbFile
+func (n *Nzb) ContentFileCount() int {
+	count := 0
+
+	for id := range n.Files {
+		if !n.Files[id].IsPar2() {
+			count++
+		}
+	}
+
+	return count
+}
+
+// returns the bytes of the file in binary units with one decimal place (e.g. 1.2 GiB), or "0 B" for zero
+// relies on Bytes as computed by ScanNzbFile
+func (f *NzbFile) SizeHuman() string {
+	return humanBytes(f.Bytes)
+}
+
+// returns the bytes of the nzb in binary units with one decimal place (e.g. 1.2 GiB), or "0 B" for zero
+// relies on Bytes as computed by ScanNzbFile
+func (n *Nzb) SizeHuman() string {
+	return humanBytes(n.Bytes)
+}
+
+// formats the bytes in 1024 based units, bytes below 1 KiB are given without decimal place
+func humanBytes(bytes int64) string {
+	const units = "KMGTPE"
+
+	if bytes < 1024 && bytes > -1024 {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	value := float64(bytes) / 1024
+	unit := 0
+
+	for unit < len(units)-1 && math.Abs(math.Round(value*10)/10) >= 1024 {
+		value = value / 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", value, units[unit])
+}
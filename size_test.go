@@ -0,0 +1,272 @@
+package nzbparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimatedPayloadBytes(t *testing.T) {
+	defer func(ratio float64) { YencOverheadRatio = ratio }(YencOverheadRatio)
+
+	nzb := &Nzb{Bytes: 102000}
+
+	YencOverheadRatio = 0.02
+	if got := nzb.EstimatedPayloadBytes(); got != 100000 {
+		t.Errorf("Expected 100000 estimated bytes, got %d", got)
+	}
+
+	YencOverheadRatio = 0
+	if got := nzb.EstimatedPayloadBytes(); got != 102000 {
+		t.Errorf("Expected 102000 estimated bytes without overhead, got %d", got)
+	}
+
+	// a negative ratio must never estimate more than the encoded size
+	YencOverheadRatio = -0.5
+	if got := nzb.EstimatedPayloadBytes(); got != 102000 {
+		t.Errorf("Expected 102000 estimated bytes for a negative ratio, got %d", got)
+	}
+
+	YencOverheadRatio = 0.02
+	if got := (&Nzb{}).EstimatedPayloadBytes(); got != 0 {
+		t.Errorf("Expected 0 estimated bytes for an empty nzb, got %d", got)
+	}
+
+	if got := (&Nzb{Bytes: -10}).EstimatedPayloadBytes(); got != 0 {
+		t.Errorf("Expected 0 estimated bytes for negative bytes, got %d", got)
+	}
+}
+
+func TestArticleCount(t *testing.T) {
+	nzb, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if got := nzb.ArticleCount(); got != 4 {
+		t.Errorf("Expected 4 articles, got %d", got)
+	}
+
+	if got := nzb.AverageSegmentBytes(); got != 250 {
+		t.Errorf("Expected 250 average segment bytes, got %d", got)
+	}
+
+	empty := &Nzb{}
+	if empty.ArticleCount() != 0 || empty.AverageSegmentBytes() != 0 {
+		t.Errorf("Expected 0 for an empty nzb, got %d and %d", empty.ArticleCount(), empty.AverageSegmentBytes())
+	}
+}
+
+func TestRecoveryRatio(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Filename: "release.part01.rar", Bytes: 600},
+			{Filename: "release.part02.rar", Bytes: 400},
+			{Filename: "release.par2", Bytes: 20},
+			{Filename: "release.vol00+01.par2", Bytes: 80},
+		},
+	}
+
+	if got := nzb.RecoveryRatio(); got != 0.1 {
+		t.Errorf("Expected recovery ratio 0.1, got %v", got)
+	}
+
+	// no par2 or no content files
+	if got := (&Nzb{Files: nzb.Files[:2]}).RecoveryRatio(); got != 0 {
+		t.Errorf("Expected 0 without par2 files, got %v", got)
+	}
+
+	if got := (&Nzb{Files: nzb.Files[2:]}).RecoveryRatio(); got != 0 {
+		t.Errorf("Expected 0 without content files, got %v", got)
+	}
+}
+
+func TestContentBytes(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Filename: "release.part01.rar", Bytes: 600},
+			{Filename: "release.part02.rar", Bytes: 400},
+			{Filename: "release.nfo", Bytes: 5},
+			{Filename: "release.par2", Bytes: 20},
+			{Filename: "release.vol00+01.par2", Bytes: 80},
+		},
+		Bytes: 1105,
+	}
+
+	if got := nzb.ContentBytes(); got != 1005 {
+		t.Errorf("Expected 1005 content bytes, got %d", got)
+	}
+
+	if got := nzb.ContentFileCount(); got != 3 {
+		t.Errorf("Expected 3 content files, got %d", got)
+	}
+
+	if nzb.Bytes != 1105 || len(nzb.Files) != 5 {
+		t.Errorf("Expected the nzb to be unchanged, got %+v", nzb)
+	}
+
+	// only par2 files
+	if got := (&Nzb{Files: nzb.Files[3:]}).ContentFileCount(); got != 0 {
+		t.Errorf("Expected no content files, got %d", got)
+	}
+}
+
+func TestSizeHuman(t *testing.T) {
+	cases := []struct {
+		bytes int64
+		size  string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{340 * 1024 * 1024, "340.0 MiB"},
+		{1024*1024 - 1, "1.0 MiB"},
+		{1288490189, "1.2 GiB"},
+		{5 << 40, "5.0 TiB"},
+	}
+
+	for _, c := range cases {
+		if got := (&NzbFile{Bytes: c.bytes}).SizeHuman(); got != c.size {
+			t.Errorf("%d: file size got %q want %q", c.bytes, got, c.size)
+		}
+
+		if got := (&Nzb{Bytes: c.bytes}).SizeHuman(); got != c.size {
+			t.Errorf("%d: nzb size got %q want %q", c.bytes, got, c.size)
+		}
+	}
+}
+
+func TestTotalBytes(t *testing.T) {
+	nzb, err := ParseString(`<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="poster" date="1" subject="[1/2] &quot;incomplete.rar&quot; yEnc (1/4)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="1">a1@test</segment>
+      <segment bytes="110" number="3">a3@test</segment>
+    </segments>
+  </file>
+  <file poster="poster" date="1" subject="[2/2] &quot;complete.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="300" number="1">b1@test</segment></segments>
+  </file>
+</nzb>`)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if nzb.Bytes != 510 {
+		t.Errorf("Expected 510 available bytes, got %d", nzb.Bytes)
+	}
+
+	if nzb.TotalBytes != 720 {
+		t.Errorf("Expected 720 total bytes, got %d", nzb.TotalBytes)
+	}
+
+	// appended files update the estimate
+	built := &Nzb{}
+	for _, file := range nzb.Files {
+		built.AppendFile(file)
+	}
+
+	if built.TotalBytes != nzb.TotalBytes {
+		t.Errorf("Expected AppendFile to estimate %d total bytes, got %d", nzb.TotalBytes, built.TotalBytes)
+	}
+
+	// complete nzbs have equal totals
+	nzb.Filter(func(file NzbFile) bool { return file.Segments.Len() >= file.TotalSegments })
+	if nzb.TotalBytes != nzb.Bytes {
+		t.Errorf("Expected the total bytes to equal the bytes of complete files, got %d and %d", nzb.TotalBytes, nzb.Bytes)
+	}
+}
+
+func TestBytesConsistent(t *testing.T) {
+	nzb, err := ParseString(`<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="poster" date="1" bytes="1000" subject="[1/3] &quot;complete.rar&quot; yEnc (1/2)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="510" number="1">a1@test</segment>
+      <segment bytes="510" number="2">a2@test</segment>
+    </segments>
+  </file>
+  <file poster="poster" date="1" bytes="1000" subject="[2/3] &quot;truncated.rar&quot; yEnc (1/2)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="510" number="1">b1@test</segment></segments>
+  </file>
+  <file poster="poster" date="1" subject="[3/3] &quot;undeclared.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="510" number="1">c1@test</segment></segments>
+  </file>
+</nzb>`)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	cases := []struct {
+		expected int64
+		actual   int64
+		ok       bool
+	}{
+		{1000, 1020, true},
+		{1000, 510, false},
+		{0, 510, false},
+	}
+
+	for id, c := range cases {
+		expected, actual, ok := nzb.Files[id].BytesConsistent()
+		if expected != c.expected || actual != c.actual || ok != c.ok {
+			t.Errorf("%s: got %d, %d, %v want %d, %d, %v", nzb.Files[id].Filename, expected, actual, ok, c.expected, c.actual, c.ok)
+		}
+	}
+
+	// the scan keeps the declared bytes
+	if nzb.Files[1].Bytes != 510 || nzb.Files[1].DeclaredBytes != 1000 {
+		t.Errorf("Expected the computed and the declared bytes, got %d and %d", nzb.Files[1].Bytes, nzb.Files[1].DeclaredBytes)
+	}
+}
+
+func TestDeclaredBytesRoundTrip(t *testing.T) {
+	nzb, err := ParseString(`<?xml version="1.0" encoding="UTF-8"?>
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="poster" date="1" bytes="123456" subject="[1/2] &quot;declared.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="510" number="1">a1@test</segment></segments>
+  </file>
+  <file poster="poster" date="1" subject="[2/2] &quot;undeclared.rar&quot; yEnc (1/1)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="510" number="1">b1@test</segment></segments>
+  </file>
+</nzb>`)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	output, err := WriteString(nzb)
+	if err != nil {
+		t.Fatalf("WriteString failed: %v", err)
+	}
+
+	if !strings.Contains(output, `bytes="123456"`) {
+		t.Errorf("Expected the declared bytes to be written:\n%s", output)
+	}
+
+	parsed, err := ParseString(output)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	// the declared bytes survive, a file without them is written with the computed bytes
+	cases := []struct {
+		bytes    int64
+		declared int64
+	}{
+		{510, 123456},
+		{510, 510},
+	}
+
+	for id, c := range cases {
+		file := parsed.Files[id]
+		if file.Bytes != c.bytes || file.DeclaredBytes != c.declared {
+			t.Errorf("%s: got %d and %d, want %d and %d", file.Filename, file.Bytes, file.DeclaredBytes, c.bytes, c.declared)
+		}
+	}
+}
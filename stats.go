@@ -0,0 +1,76 @@
+package nzbparser
+
+import (
+	"strings"
+	"time"
+)
+
+// summary of an nzb as returned by Stats
+type NzbStats struct {
+	Files          int            // number of available files
+	TotalFiles     int            // number of total files based on the subject count
+	Segments       int            // number of available segments
+	TotalSegments  int            // number of total segments based on the subject count
+	Bytes          int64          // total size of all available segments
+	EstimatedBytes int64          // estimated decoded size of all available segments (see EstimatedPayloadBytes)
+	Categories     map[string]int // number of files per category (see Category)
+	Earliest       time.Time      // earliest post date of the files (zero if unknown)
+	Latest         time.Time      // latest post date of the files (zero if unknown)
+	Groups         int            // number of distinct groups
+}
+
+// returns a summary of the nzb computed in a single pass over the files
+// relies on the file information as computed by ScanNzbFile
+func (n *Nzb) Stats() NzbStats {
+	stats := NzbStats{
+		Files:      n.Files.Len(),
+		TotalFiles: n.TotalFiles,
+		Categories: make(map[string]int),
+	}
+
+	groups := make(map[string]struct{})
+
+	for id := range n.Files {
+		file := &n.Files[id]
+
+		stats.Segments = stats.Segments + file.Segments.Len()
+		stats.TotalSegments = stats.TotalSegments + file.TotalSegments
+		stats.Bytes = stats.Bytes + file.Bytes
+		stats.Categories[file.Category()]++
+
+		if posted := file.PostedAt(); !posted.IsZero() {
+			if stats.Earliest.IsZero() || posted.Before(stats.Earliest) {
+				stats.Earliest = posted
+			}
+
+			if posted.After(stats.Latest) {
+				stats.Latest = posted
+			}
+		}
+
+		for _, group := range file.Groups {
+			if group = strings.TrimSpace(group); group != "" {
+				groups[group] = struct{}{}
+			}
+		}
+	}
+
+	// never less total files than available files, like ScanNzbFile
+	stats.TotalFiles = max(stats.TotalFiles, stats.Files)
+	stats.EstimatedBytes = estimatePayload(stats.Bytes)
+	stats.Groups = len(groups)
+
+	return stats
+}
+
+// returns the number of available segments per category (see Category) computed in a single pass over the files
+// relies on the filenames as computed by ScanNzbFile, the map is empty for an nzb without files
+func (n *Nzb) SegmentCountByCategory() map[string]int {
+	counts := make(map[string]int)
+
+	for id := range n.Files {
+		counts[n.Files[id].Category()] += n.Files[id].Segments.Len()
+	}
+
+	return counts
+}
@@ -0,0 +1,94 @@
+package nzbparser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{
+				Subject:  `[1/5] Release - "release.mkv" yEnc (1/3)`,
+				Date:     1234567890,
+				Groups:   []string{"alt.test", "alt.misc"},
+				Segments: []NzbSegment{{Number: 1, Bytes: 1000, ID: "a-1"}, {Number: 2, Bytes: 1000, ID: "a-2"}},
+			},
+			{
+				Subject:  `[2/5] Release - "release.rar" yEnc (1/1)`,
+				Date:     1234567800,
+				Groups:   []string{" alt.test "},
+				Segments: []NzbSegment{{Number: 1, Bytes: 500, ID: "b-1"}},
+			},
+			{
+				Subject:  `[3/5] Release - "release.par2" yEnc (1/1)`,
+				Date:     1234567999,
+				Groups:   []string{"alt.test"},
+				Segments: []NzbSegment{{Number: 1, Bytes: 40, ID: "c-1"}},
+			},
+			{
+				Subject:  `[4/5] Release - "release.nfo" yEnc (1/1)`,
+				Groups:   []string{"alt.test"},
+				Segments: []NzbSegment{{Number: 1, Bytes: 10, ID: "d-1"}},
+			},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	stats := nzb.Stats()
+
+	if stats.Files != 4 || stats.TotalFiles != 5 {
+		t.Errorf("Unexpected file counts %d of %d", stats.Files, stats.TotalFiles)
+	}
+
+	if stats.Segments != 5 || stats.TotalSegments != 6 {
+		t.Errorf("Unexpected segment counts %d of %d", stats.Segments, stats.TotalSegments)
+	}
+
+	if stats.Bytes != 2550 || stats.EstimatedBytes != nzb.EstimatedPayloadBytes() {
+		t.Errorf("Unexpected bytes %d, estimated %d", stats.Bytes, stats.EstimatedBytes)
+	}
+
+	for category, count := range map[string]int{CategoryVideo: 1, CategoryArchive: 1, CategoryPar2: 1, CategoryNfo: 1, CategoryOther: 0} {
+		if stats.Categories[category] != count {
+			t.Errorf("Expected %d %s files, got %d", count, category, stats.Categories[category])
+		}
+	}
+
+	if !stats.Earliest.Equal(time.Unix(1234567800, 0)) || !stats.Latest.Equal(time.Unix(1234567999, 0)) {
+		t.Errorf("Unexpected post dates %v - %v", stats.Earliest, stats.Latest)
+	}
+
+	if stats.Groups != 2 {
+		t.Errorf("Expected 2 distinct groups, got %d", stats.Groups)
+	}
+
+	empty := (&Nzb{}).Stats()
+	if empty.Files != 0 || !empty.Earliest.IsZero() || !empty.Latest.IsZero() || empty.Groups != 0 {
+		t.Errorf("Unexpected stats for an empty nzb: %+v", empty)
+	}
+}
+
+func TestSegmentCountByCategory(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: `[1/4] "release.part01.rar" yEnc (1/2)`, Segments: []NzbSegment{{Number: 1, ID: "a-1"}, {Number: 2, ID: "a-2"}}},
+			{Subject: `[2/4] "release.part02.rar" yEnc (1/1)`, Segments: []NzbSegment{{Number: 1, ID: "b-1"}}},
+			{Subject: `[3/4] "release.vol00+01.par2" yEnc (1/3)`, Segments: []NzbSegment{{Number: 1, ID: "c-1"}, {Number: 2, ID: "c-2"}, {Number: 3, ID: "c-3"}}},
+			{Subject: `[4/4] "release.mkv" yEnc (1/1)`},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	expected := map[string]int{CategoryArchive: 3, CategoryPar2: 3, CategoryVideo: 0}
+	if counts := nzb.SegmentCountByCategory(); !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Expected segment counts %v, got %v", expected, counts)
+	}
+
+	if counts := (&Nzb{}).SegmentCountByCategory(); counts == nil || len(counts) != 0 {
+		t.Errorf("Expected an empty map, got %v", counts)
+	}
+}
@@ -0,0 +1,94 @@
+package nzbparser
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// parse nzb file provided as io.Reader buffer and hand every file to fn as soon as it has been decoded
+// the files are scanned individually (filename, number, totals) but neither deduplicated nor sorted,
+// and the nzb as a whole is never held in memory
+// a non-nil error returned by fn stops the decoding and is returned as it is
+func ParseStream(buf io.Reader, fn func(NzbFile) error) error {
+	_, err := decodeNzb(buf, ParseOptions{}, func(file NzbFile) error {
+		cleanSegmentIDs(&file, true)
+		scanFile(&file, ParseOptions{})
+		return fn(file)
+	})
+
+	return err
+}
+
+// writes an nzb file by file without holding it in memory, the output is the same as with Write
+// for an nzb with the given meta data, comment and files in the order of WriteFile
+type StreamWriter struct {
+	encoder *xml.Encoder
+	closed  bool
+}
+
+// write the header, the comment and the head with the meta data to w and open the nzb element for the files
+func NewStreamWriter(w io.Writer, meta map[string]string, comment string) (*StreamWriter, error) {
+	if _, err := io.WriteString(w, Header); err != nil {
+		return nil, err
+	}
+
+	sw := &StreamWriter{encoder: xml.NewEncoder(w)}
+	sw.encoder.Indent("", "  ")
+
+	start := xml.StartElement{
+		Name: xml.Name{Local: "nzb"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: Xmlns}},
+	}
+
+	if err := sw.encoder.EncodeToken(start); err != nil {
+		return nil, err
+	}
+
+	// the encoder doesn't indent comment tokens, so the comment is written like a head comment
+	if comment != "" {
+		xcomment := xNzbComment{text: " " + comment + " ", before: "\n  ", w: w}
+		if err := xcomment.MarshalXML(sw.encoder, xml.StartElement{}); err != nil {
+			return nil, err
+		}
+	}
+
+	head := xNzbStreamHead{Metadata: metaElements(&Nzb{Meta: meta})}
+	if err := sw.encoder.EncodeElement(head, xml.StartElement{Name: xml.Name{Local: "head"}}); err != nil {
+		return nil, err
+	}
+
+	return sw, sw.encoder.Flush()
+}
+
+// write the file element with its segments sorted by number like Write
+func (sw *StreamWriter) WriteFile(f NzbFile) error {
+	if sw.closed {
+		return ErrWriterClosed
+	}
+
+	if err := f.marshalXML(sw.encoder, xml.StartElement{Name: xml.Name{Local: "file"}}, WriteOptions{}); err != nil {
+		return err
+	}
+
+	return sw.encoder.Flush()
+}
+
+// close the nzb element, the underlying writer is not closed
+func (sw *StreamWriter) Close() error {
+	if sw.closed {
+		return ErrWriterClosed
+	}
+
+	sw.closed = true
+
+	if err := sw.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: "nzb"}}); err != nil {
+		return err
+	}
+
+	return sw.encoder.Flush()
+}
+
+// temp nzb head struct for the meta data written by the stream writer
+type xNzbStreamHead struct {
+	Metadata []xNzbMeta `xml:"meta"`
+}
@@ -0,0 +1,169 @@
+package nzbparser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const streamTestNZB = Header + `<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <head>
+    <meta type="title">Stream Title</meta>
+  </head>
+  <file poster="test@example.com" date="1234567890" subject="[2/3] Stream - &quot;file2.rar&quot; yEnc (1/2)">
+    <groups>
+      <group>alt.test</group>
+    </groups>
+    <segments>
+      <segment bytes="200" number="2">seg-2-2</segment>
+      <segment bytes="100" number="1">seg-2-1</segment>
+    </segments>
+  </file>
+  <file poster="test@example.com" date="1234567890" subject="[1/3] Stream - &quot;file1.rar&quot; yEnc (1/1)">
+    <groups>
+      <group>alt.test</group>
+    </groups>
+    <segments>
+      <segment bytes="300" number="1">seg-1-1</segment>
+    </segments>
+  </file>
+  <file poster="test@example.com" date="1234567890" subject="[3/3] Stream - &quot;file3.par2&quot; yEnc (1/1)">
+    <groups>
+      <group>alt.test</group>
+    </groups>
+    <segments>
+      <segment bytes="400" number="1">seg-3-1</segment>
+    </segments>
+  </file>
+</nzb>`
+
+func TestParseStream(t *testing.T) {
+	var files []NzbFile
+
+	err := ParseStream(strings.NewReader(streamTestNZB), func(file NzbFile) error {
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ParseStream failed: %v", err)
+	}
+
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 files, got %d", len(files))
+	}
+
+	// files are handed over in document order without sorting
+	if files[0].Filename != "file2.rar" || files[1].Filename != "file1.rar" || files[2].Filename != "file3.par2" {
+		t.Errorf("Unexpected file order: %q, %q, %q", files[0].Filename, files[1].Filename, files[2].Filename)
+	}
+
+	file := files[0]
+	if file.Subject != `[2/3] Stream - "file2.rar" yEnc (1/2)` {
+		t.Errorf("Unexpected subject %q", file.Subject)
+	}
+
+	if len(file.Groups) != 1 || file.Groups[0] != "alt.test" {
+		t.Errorf("Expected group 'alt.test', got %v", file.Groups)
+	}
+
+	if len(file.Segments) != 2 || file.Segments[0].ID != "seg-2-2" {
+		t.Errorf("Unexpected segments %+v", file.Segments)
+	}
+
+	if file.Number != 2 || file.TotalSegments != 2 || file.Bytes != 300 {
+		t.Errorf("Unexpected scan results: number %d, total segments %d, bytes %d", file.Number, file.TotalSegments, file.Bytes)
+	}
+}
+
+func TestParseStreamStopsOnCallbackError(t *testing.T) {
+	errStop := errors.New("stop")
+	calls := 0
+
+	err := ParseStream(strings.NewReader(streamTestNZB), func(file NzbFile) error {
+		calls++
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("Expected callback error to be returned, got %v", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected decoding to stop after the first file, got %d calls", calls)
+	}
+}
+
+func TestParseStreamInvalid(t *testing.T) {
+	err := ParseStream(strings.NewReader("This is not a valid NZB file"), func(file NzbFile) error {
+		t.Error("Callback should not be called for an invalid NZB")
+		return nil
+	})
+	if err == nil {
+		t.Error("Expected error for invalid NZB, got nil")
+	}
+
+	err = ParseStream(strings.NewReader(`<notnzb><file subject="x"/></notnzb>`), func(file NzbFile) error {
+		t.Error("Callback should not be called for a wrong root element")
+		return nil
+	})
+	if err == nil {
+		t.Error("Expected error for wrong root element, got nil")
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	nzb, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	nzb.Files[0].Attrs = map[string]string{"x-custom": "value"}
+
+	cases := []struct {
+		meta    map[string]string
+		comment string
+	}{
+		{nzb.Meta, "streamed comment"},
+		{nil, ""},
+	}
+
+	for _, c := range cases {
+		expected, err := Write(&Nzb{Meta: c.meta, Comment: c.comment, Files: nzb.Files})
+		if err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		var buf strings.Builder
+
+		sw, err := NewStreamWriter(&buf, c.meta, c.comment)
+		if err != nil {
+			t.Fatalf("NewStreamWriter failed: %v", err)
+		}
+
+		for _, file := range nzb.Files {
+			if err := sw.WriteFile(file); err != nil {
+				t.Fatalf("WriteFile failed: %v", err)
+			}
+		}
+
+		if err := sw.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		if buf.String() != string(expected) {
+			t.Errorf("Expected the output of Write:\n%s\ngot:\n%s", expected, buf.String())
+		}
+
+		parsed, err := ParseString(buf.String())
+		if err != nil {
+			t.Fatalf("Parse of the streamed nzb failed: %v", err)
+		}
+
+		if len(parsed.Files) != len(nzb.Files) || parsed.Comment != c.comment {
+			t.Errorf("Expected %d files and comment %q, got %d files and comment %q", len(nzb.Files), c.comment, len(parsed.Files), parsed.Comment)
+		}
+
+		if err := sw.WriteFile(nzb.Files[0]); !errors.Is(err, ErrWriterClosed) {
+			t.Errorf("Expected ErrWriterClosed after Close, got %v", err)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package nzbparser
 
 import (
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type Subject struct {
@@ -15,6 +17,97 @@ type Subject struct {
 	TotalFiles    int    // number of total files in the file set (=Y in [X/Y])
 	Segment       int    // number of the segment of this file (=X in (X/Y))
 	TotalSegments int    // number of total segments for this file (=Y in (X/Y))
+	Size          int64  // size of the file as stated after "yEnc" (0 if not indicated)
+	Remainder     string // text left over by the parser besides the numbers, header, filename and "yEnc" with the size (for debugging)
+	Corrected     bool   // whether TotalFiles was raised to File because the subject stated a lower total ([30/23])
+}
+
+// precompiled regular expressions of the subject parser
+var (
+	// multipart rar volume extensions (r00, r01, ...)
+	dynamicArchiveRE = regexp.MustCompile(`(?i)r\d{2}$`)
+	// file numbers [X/Y] and segment numbers (X/Y)
+	subjectNumbersRE = regexp.MustCompile(`(?i)(?:(?P<remainder>.*?) *(?:(?P<files>(?:"?\[|[<[]? *)(?P<file>\d+) */ *(?P<totalfiles>\d+) *(?:\]"?|[>\]])?)|(?P<segments>"?\((?P<segment>\d+) */ *(?P<totalsegments>\d+)\)"?))|.*$)`)
+	// file numbers stated as "X of Y"
+	subjectOfNumbersRE = regexp.MustCompile(`(?i)(?:(?P<remainder1>.*?) *(?P<files>(?:\[|[<[]? *(?:file|datei)?) *(?P<file>\d+) *(?:of|von) *(?P<totalfiles>\d+) *(?:\]|[>\]])?)(?P<remainder2>.*$))`)
+	// file size stated after "yEnc"
+	subjectSizeRE = regexp.MustCompile(`(?i)\byenc\s+(?P<size>\d+)(?:\s|\(|$)`)
+	// header followed by a quoted filename
+	quotedFilenameRE = regexp.MustCompile(`(?i)^(?P<header>.*?)?[- ]*"+(?P<filename>(?P<basefilename>.*?)(?:\.(?P<extension>(?:7z\.)?(?:vol\d+\+\d+\.par2?|part\d+\.[^ "\.]*|[^ "\.]*\.\d+|[^ "\.]*)))?)"+`)
+	// unquoted filename with a known extension
+	unquotedFilenameRE = regexp.MustCompile(`(?i)^(?P<filename>(?P<basefilename>.*)\.(?P<extension>(?:vol\d+\+\d+\.par2?|part\d+\.rar|r\d{2,3}|mkv|avi|mp4|mov|wmv|flv|webm|m4v|mpg|mpeg|rar|zip|7z|tar|gz|bz2|nfo|sfv|par2?|txt|md|log|jpg|jpeg|png|gif|bmp|svg|pdf|doc|docx|xls|xlsx|ppt|pptx|mp3|flac|m4a|wav|ogg|aac|wma)))(?:\s|$)`)
+	// any quoted string
+	quotedStringRE = regexp.MustCompile(`"([^\"]+)"`)
+	// filename with extension
+	fileWithExtRE = regexp.MustCompile(`(?i)^(?P<basefilename>.*?)\.(?:7z\.)?(?:vol\d+\+\d+\.par2?|part\d+\.[^ "\.]*|[^ "\.]*\.\d+|[^ "\.]*?)$`)
+	// filename with a (compound) extension to check against KnownExtensions
+	candidateFilenameRE = regexp.MustCompile(`(?i)^(?P<base>.+?)\.(?P<ext>vol\d+\+\d+\.par2|part\d+\.rar|[^.]+)$`)
+	// filename within square brackets
+	bracketFilenameRE = regexp.MustCompile(`\[(?P<filename>(?P<basefilename>[^\[\]/]+?)\.(?: 7z\.)?(?:vol\d+\+\d+\.par2?|part\d+\.[^\s\"\.\[\]]*|r\d{2,3}|[^\s\"\.\[\]]+))\]`)
+	// run of leading indexer tags without dots like [PRiVATE]-[WtFnZb]-
+	leadingTagsRE = regexp.MustCompile(`^(?:\[[^\[\]./"]+\] *-? *)+`)
+	// leading file number pairs followed by the remaining subject
+	leadingNumbersRE = regexp.MustCompile(`^(?: *(?:"?\[|[<[]?)\d+ */ *\d+ *(?:\]"?|[>\]])?)+ *(?P<tail>.*)$`)
+	// season and episode numbers (s03e07, 3x07, season 3 episode 7)
+	seasonEpisodeRE  = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])s(\d{1,3})[ ._-]?e(\d{1,4})`)
+	seasonXEpisodeRE = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(\d{1,2})x(\d{2,3})(?:[^a-z0-9]|$)`)
+	seasonWordsRE    = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])season[ ._-]*(\d{1,3})[ ._-]*episode[ ._-]*(\d{1,4})`)
+	// split 7z volume extension (name.7z.001)
+	splitSevenZipRE = regexp.MustCompile(`(?i)\.7z\.\d{3}$`)
+	// "yEnc" with the size and the empty quotes and brackets left over after taking out the filename
+	leftoverRE = regexp.MustCompile(`(?i)\(?\byenc\b\)?(?:\s+\d+)?|""|\[\s*\]|\(\s*\)`)
+	// part counters like (1/50) or [1/5] left after the filename
+	partCounterRE = regexp.MustCompile(`[(\[] *\d+ */ *\d+ *[)\]]`)
+	// "yEnc" as separate token at the end of the header, optionally in parentheses and followed by the size
+	headerYencRE = regexp.MustCompile(`(?i)(?:^|[\s\-]+)\(?yenc\)?(?:\s+\d+)?[\s\-]*$`)
+	// quoted filename within the remaining subject
+	tailFilenameRE = regexp.MustCompile(`(?i)"+(?P<filename>(?P<basefilename>.*?)(?:\.(?P<extension>(?:7z\.)?(?:vol\d+\+\d+\.par2?|part\d+\.[^ "\.]*|[^ "\.]*\.\d+|[^ "\.]*)))?)"+`)
+)
+
+// maximum file and segment number taken from a subject, larger numbers are treated as unknown
+// this guards the allocations based on the totals (e.g. MissingSegments) against crafted subjects
+var MaxSubjectTotal = 100000
+
+// converts a file or segment number of the subject, numbers which don't fit or exceed MaxSubjectTotal are unknown (0)
+func subjectNumber(number string) int {
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 || n > MaxSubjectTotal {
+		return 0
+	}
+
+	return n
+}
+
+// file extensions (lowercase, without the leading dot) recognized as real extensions
+// when the subject parser has to choose between multiple quoted strings
+// multipart rar volumes (r00, r01, ...) are always recognized
+var KnownExtensions = map[string]struct{}{
+	"rar": {}, "r00": {}, "r01": {}, "r02": {}, "r03": {}, "r04": {}, "r05": {},
+	"par2": {}, "nfo": {}, "sfv": {}, "zip": {}, "7z": {},
+	"mp4": {}, "mkv": {}, "avi": {}, "mov": {},
+	"mp3": {}, "flac": {}, "m4a": {},
+	"jpg": {}, "jpeg": {}, "png": {}, "gif": {},
+	"pdf": {}, "txt": {},
+}
+
+// add a file extension to KnownExtensions, a leading dot is removed and the extension is lowercased
+// the map is not guarded against concurrent access, so register extensions at init time
+func RegisterExtension(ext string) {
+	ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), "."))
+	if ext != "" {
+		KnownExtensions[ext] = struct{}{}
+	}
+}
+
+// check if the extension is a known extension
+func isKnownExtension(ext string) bool {
+	ext = strings.ToLower(ext)
+	if _, ok := KnownExtensions[ext]; ok {
+		return true
+	}
+
+	// treat dynamic rXX as known even if not enumerated
+	return dynamicArchiveRE.MatchString(ext)
 }
 
 // the Parse method analyses a given string and returns the Subject structure
@@ -34,8 +127,7 @@ func ParseSubject(s string) (Subject, error) {
 	// we also assume that max. two number pairs are present (segment numbers or segment and file numbers)
 	// we further assume that if both number pairs are present the last one are the segment numbers,
 	// and that no relevant info apperars in the subject after them (usualy only "yEnc" and the size is stated after the segment numbers)
-	r := regexp.MustCompile(`(?i)(?:(?P<remainder>.*?) *(?:(?P<files>(?:"?\[|[<[]? *)(?P<file>\d+) */ *(?P<totalfiles>\d+) *(?:\]"?|[>\]])?)|(?P<segments>"?\((?P<segment>\d+) */ *(?P<totalsegments>\d+)\)"?))|.*$)`)
-	matches := findAllNamedMatches(r, subject.Subject)
+	matches := findAllNamedMatches(subjectNumbersRE, subject.Subject)
 	foundNumbers := false
 	if matches != nil {
 		// check the matches from back to start
@@ -44,12 +136,12 @@ func ParseSubject(s string) (Subject, error) {
 				// if neither segments nor files are assigned yet, we just assign
 				if matches[counter]["files"] != "" {
 					foundNumbers = true
-					subject.File, _ = strconv.Atoi(matches[counter]["file"])
-					subject.TotalFiles, _ = strconv.Atoi(matches[counter]["totalfiles"])
+					subject.File = subjectNumber(matches[counter]["file"])
+					subject.TotalFiles = subjectNumber(matches[counter]["totalfiles"])
 				} else if matches[counter]["segments"] != "" { // we have either [files] or (segments) in a match but not both
 					foundNumbers = true
-					subject.Segment, _ = strconv.Atoi(matches[counter]["segment"])
-					subject.TotalSegments, _ = strconv.Atoi(matches[counter]["totalsegments"])
+					subject.Segment = subjectNumber(matches[counter]["segment"])
+					subject.TotalSegments = subjectNumber(matches[counter]["totalsegments"])
 				}
 			} else if subject.TotalFiles == 0 || subject.TotalSegments == 0 {
 				// one of them is already assigned, we do some checks
@@ -67,11 +159,11 @@ func ParseSubject(s string) (Subject, error) {
 					// if not, probably only segment numbers are present but use square brackets
 					// in this case we assign the "file" numbers to the segments
 					if subject.TotalSegments == 0 {
-						subject.Segment, _ = strconv.Atoi(matches[counter]["file"])
-						subject.TotalSegments, _ = strconv.Atoi(matches[counter]["totalfiles"])
+						subject.Segment = subjectNumber(matches[counter]["file"])
+						subject.TotalSegments = subjectNumber(matches[counter]["totalfiles"])
 					} else {
-						subject.File, _ = strconv.Atoi(matches[counter]["file"])
-						subject.TotalFiles, _ = strconv.Atoi(matches[counter]["totalfiles"])
+						subject.File = subjectNumber(matches[counter]["file"])
+						subject.TotalFiles = subjectNumber(matches[counter]["totalfiles"])
 					}
 				} else if matches[counter]["segments"] != "" { // we have either [files] or (segments) in a match but not both
 					foundNumbers = true
@@ -80,11 +172,11 @@ func ParseSubject(s string) (Subject, error) {
 					// in this case we assume that segment numbers are at the end
 					// and assign these "segment" numbers to the files
 					if subject.TotalSegments != 0 {
-						subject.File, _ = strconv.Atoi(matches[counter]["segment"])
-						subject.TotalFiles, _ = strconv.Atoi(matches[counter]["totalsegments"])
+						subject.File = subjectNumber(matches[counter]["segment"])
+						subject.TotalFiles = subjectNumber(matches[counter]["totalsegments"])
 					} else {
-						subject.Segment, _ = strconv.Atoi(matches[counter]["segment"])
-						subject.TotalSegments, _ = strconv.Atoi(matches[counter]["totalsegments"])
+						subject.Segment = subjectNumber(matches[counter]["segment"])
+						subject.TotalSegments = subjectNumber(matches[counter]["totalsegments"])
 					}
 				}
 			}
@@ -110,11 +202,10 @@ func ParseSubject(s string) (Subject, error) {
 	// check if we have found some file numbers
 	if subject.TotalFiles == 0 {
 		// if no file numbers were found we first try some edge cases like "x of y"
-		r := regexp.MustCompile(`(?i)(?:(?P<remainder1>.*?) *(?P<files>(?:\[|[<[]? *(?:file|datei)?) *(?P<file>\d+) *(?:of|von) *(?P<totalfiles>\d+) *(?:\]|[>\]])?)(?P<remainder2>.*$))`)
-		matches := findAllNamedMatches(r, remainder)
+		matches := findAllNamedMatches(subjectOfNumbersRE, remainder)
 		if matches != nil && matches[0]["files"] != "" {
-			subject.File, _ = strconv.Atoi(matches[0]["file"])
-			subject.TotalFiles, _ = strconv.Atoi(matches[0]["totalfiles"])
+			subject.File = subjectNumber(matches[0]["file"])
+			subject.TotalFiles = subjectNumber(matches[0]["totalfiles"])
 			remainder = strings.TrimSpace(strings.TrimSpace(matches[0]["remainder1"]) + " " + strings.TrimSpace(matches[0]["remainder2"]))
 		} else {
 			// if still nothing was found, we assume it is a single file post
@@ -123,12 +214,29 @@ func ParseSubject(s string) (Subject, error) {
 		}
 	}
 
+	// a file number beyond the total (corrupt subjects like [30/23]) raises the total, so the file is never out of range
+	if subject.File > subject.TotalFiles {
+		subject.TotalFiles = subject.File
+		subject.Corrected = true
+	}
+
+	// search for the file size, usually stated as a bare number after "yEnc" and before the segment numbers
+	if matches := findAllNamedMatches(subjectSizeRE, subject.Subject); matches != nil {
+		subject.Size, _ = strconv.ParseInt(matches[0]["size"], 10, 64)
+	}
+
+	// skip the leading indexer tags, they are neither part of the header nor of the filename
+	// the tags are still part of the remainder given in the subject
+	tagged := remainder
+	if tags := leadingTagsRE.FindString(remainder); tags != "" && strings.TrimSpace(remainder[len(tags):]) != "" {
+		remainder = remainder[len(tags):]
+	}
+
 	// now search for the header and the file name
 	// we first assume that the filename is between quotes and may or may not end with an extension
 	// we also assume that there is no more relevant information after the filename
 	// everything before the filename is considered to be the header
-	r = regexp.MustCompile(`(?i)^(?P<header>.*?)?[- ]*"+(?P<filename>(?P<basefilename>.*?)(?:\.(?P<extension>(?:7z\.)?(?:vol\d+\+\d+\.par2?|part\d+\.[^ "\.]*|[^ "\.]*\.\d+|[^ "\.]*)))?)"+`)
-	matches = findAllNamedMatches(r, remainder)
+	matches = findAllNamedMatches(quotedFilenameRE, remainder)
 	if matches != nil {
 		subject.Header = strings.Trim(matches[0]["header"], " -")
 		subject.Filename = strings.Trim(matches[0]["filename"], " -")
@@ -136,14 +244,35 @@ func ParseSubject(s string) (Subject, error) {
 	} else {
 		// if no filename was found between quotes, we assume the whole remaining subject is the filename and we only search for an extension
 		// Use greedy matching (.*) to prefer the LAST occurrence of a known extension, avoiding false matches on dots in the middle of filenames
-		r = regexp.MustCompile(`(?i)^(?P<filename>(?P<basefilename>.*)\.(?P<extension>(?:vol\d+\+\d+\.par2?|part\d+\.rar|r\d{2,3}|mkv|avi|mp4|mov|wmv|flv|webm|m4v|mpg|mpeg|rar|zip|7z|tar|gz|bz2|nfo|sfv|par2?|txt|md|log|jpg|jpeg|png|gif|bmp|svg|pdf|doc|docx|xls|xlsx|ppt|pptx|mp3|flac|m4a|wav|ogg|aac|wma)))(?:\s|$)`)
-		matches = findAllNamedMatches(r, remainder)
+		matches = findAllNamedMatches(unquotedFilenameRE, remainder)
 		if matches != nil {
-			subject.Filename = strings.Trim(matches[0]["filename"], " -")
-			subject.Basefilename = strings.Trim(matches[0]["basefilename"], " -")
+			filename := matches[0]["filename"]
+			basefilename := matches[0]["basefilename"]
+			// if more text follows the filename, e.g. "Group presents file.name.mkv more text",
+			// the filename is the last word ending with the extension and the text before it is the header
+			// "yEnc" with the size and part counters are no text of the poster, so they don't count as text
+			// otherwise the filename may contain spaces and only a " - " separates a header from it
+			trailing := leftoverRE.ReplaceAllString(remainder[len(filename):], "")
+			trailing = partCounterRE.ReplaceAllString(trailing, "")
+
+			var idx, sep int
+			if strings.Trim(trailing, " \t-") != "" {
+				idx, sep = strings.LastIndexAny(filename, " \t"), 1
+			} else {
+				idx, sep = strings.LastIndex(filename, " - "), len(" - ")
+			}
+
+			if idx != -1 && idx < len(basefilename) {
+				subject.Header = strings.Trim(filename[:idx], " -")
+				filename = filename[idx+sep:]
+				basefilename = basefilename[idx+sep:]
+			}
+			subject.Filename = strings.Trim(filename, " -")
+			subject.Basefilename = strings.Trim(basefilename, " -")
 		} else {
 			// if no filename with extension was found and it is a single file post, we take everything as the (base)fileame
-			if subject.TotalFiles == 1 {
+			// unless the filename is within square brackets, which is handled below
+			if subject.TotalFiles == 1 && !bracketFilenameRE.MatchString(remainder) {
 				subject.Filename = strings.Trim(remainder, " -")
 				subject.Basefilename = strings.Trim(remainder, " -")
 			}
@@ -154,11 +283,9 @@ func ParseSubject(s string) (Subject, error) {
 	// Example: [04/23] "Release.Name" - "release.name.r00" - yEnc(1/140)
 	// If we only captured a filename without extension while there are multiple quoted strings, prefer the later quoted string that has an extension.
 	if subject.Filename != "" && subject.Filename == subject.Basefilename { // no extension captured
-		quoteRE := regexp.MustCompile(`"([^\"]+)"`)
-		quoted := quoteRE.FindAllStringSubmatch(remainder, -1)
+		quoted := quotedStringRE.FindAllStringSubmatch(remainder, -1)
 		if len(quoted) > 1 {
 			// pattern to detect filename with extension (reuse existing extension logic)
-			fileWithExtRE := regexp.MustCompile(`(?i)^(?P<basefilename>.*?)\.(?:7z\.)?(?:vol\d+\+\d+\.par2?|part\d+\.[^ "\.]*|[^ "\.]*\.\d+|[^ "\.]*?)$`)
 			for i := 1; i < len(quoted); i++ { // skip first, as it was already treated as filename/header
 				candidate := strings.TrimSpace(quoted[i][1])
 				m := fileWithExtRE.FindStringSubmatch(candidate)
@@ -186,8 +313,7 @@ func ParseSubject(s string) (Subject, error) {
 
 	// Heuristic: even if we captured an extension, determine if it's a real file extension. If not and multiple quoted strings exist, try to pick a better candidate (e.g. second quoted string with real archive/media extension)
 	if subject.Filename != "" { // attempt refinement
-		quoteRE := regexp.MustCompile(`"([^\"]+)"`)
-		quoted := quoteRE.FindAllStringSubmatch(remainder, -1)
+		quoted := quotedStringRE.FindAllStringSubmatch(remainder, -1)
 		if len(quoted) > 1 {
 			// Extract extension from current filename
 			cur := subject.Filename
@@ -196,15 +322,10 @@ func ParseSubject(s string) (Subject, error) {
 			if idx != -1 {
 				curExt = strings.ToLower(cur[idx+1:])
 			}
-			known := map[string]struct{}{"rar": {}, "r00": {}, "r01": {}, "r02": {}, "par2": {}, "nfo": {}, "sfv": {}, "zip": {}, "7z": {}, "mp4": {}, "mkv": {}, "avi": {}, "mov": {}, "mp3": {}, "flac": {}, "m4a": {}, "jpg": {}, "jpeg": {}, "png": {}, "gif": {}, "pdf": {}, "txt": {}, "r03": {}, "r04": {}, "r05": {}}
-			_, curKnown := known[curExt]
-			// treat dynamic rXX, partXX.rar as known even if not enumerated
-			isDynamicArchive := regexp.MustCompile(`(?i)r\d{2}$`).MatchString(curExt)
-			if !curKnown && !isDynamicArchive { // try to find better candidate
-				candidateRE := regexp.MustCompile(`(?i)^(?P<base>.+?)\.(?P<ext>(?:vol\d+\+\d+\.par2|par2|part\d+\.rar|r\d{2}|rar|nfo|sfv|zip|7z|mp4|mkv|avi|mov|mp3|flac|m4a|jpg|jpeg|png|gif|pdf|txt))$`)
+			if !isKnownExtension(curExt) { // try to find better candidate
 				for i := 1; i < len(quoted); i++ { // skip first
 					cand := strings.TrimSpace(quoted[i][1])
-					if m := candidateRE.FindStringSubmatch(cand); m != nil {
+					if m := candidateFilenameRE.FindStringSubmatch(cand); m != nil && isKnownExtension(m[2][strings.LastIndex(m[2], ".")+1:]) {
 						// set header to first quoted (release) if not already meaningful
 						if subject.Header == "" || subject.Header == subject.Basefilename || strings.EqualFold(subject.Header, subject.Filename) {
 							subject.Header = strings.Trim(quoted[0][1], " -")
@@ -221,8 +342,7 @@ func ParseSubject(s string) (Subject, error) {
 	// Additional handling: some subjects have the filename within square brackets instead of quotes
 	// Example: [PRiVATE]-[WtFnZb]-[test.h264-tripel.r10]-[13/21] - "" yEnc
 	if subject.Filename == "" {
-		bracketRE := regexp.MustCompile(`\[(?P<filename>(?P<basefilename>[^\[\]/]+?)\.(?: 7z\.)?(?:vol\d+\+\d+\.par2?|part\d+\.[^\s\"\.\[\]]*|r\d{2,3}|[^\s\"\.\[\]]+))\]`)
-		bracketMatches := findAllNamedMatches(bracketRE, remainder)
+		bracketMatches := findAllNamedMatches(bracketFilenameRE, remainder)
 		if bracketMatches != nil {
 			// Use the last match (typically right before file numbers)
 			for i := len(bracketMatches) - 1; i >= 0; i-- {
@@ -244,11 +364,10 @@ func ParseSubject(s string) (Subject, error) {
 
 	// Fallback: if we still have no filename but there are quoted parts after leading bracket pairs, attempt to extract.
 	if subject.Filename == "" {
-		leadBrackets := regexp.MustCompile(`^(?: *(?:"?\[|[<[]?)\d+ */ *\d+ *(?:\]"?|[>\]])?)+ *(?P<tail>.*)$`)
-		if m := leadBrackets.FindStringSubmatch(subject.Subject); m != nil {
+		if m := leadingNumbersRE.FindStringSubmatch(subject.Subject); m != nil {
 			// identify tail index
 			idxTail := -1
-			for i, name := range leadBrackets.SubexpNames() {
+			for i, name := range leadingNumbersRE.SubexpNames() {
 				if name == "tail" {
 					idxTail = i
 					break
@@ -257,12 +376,11 @@ func ParseSubject(s string) (Subject, error) {
 			if idxTail != -1 {
 				tail := strings.TrimSpace(m[idxTail])
 				// look for quoted filename in tail
-				q := regexp.MustCompile(`(?i)"+(?P<filename>(?P<basefilename>.*?)(?:\.(?P<extension>(?:7z\.)?(?:vol\d+\+\d+\.par2?|part\d+\.[^ "\.]*|[^ "\.]*\.\d+|[^ "\.]*)))?)"+`)
-				if qm := q.FindStringSubmatch(tail); qm != nil {
+				if qm := tailFilenameRE.FindStringSubmatch(tail); qm != nil {
 					groups := make(map[string]string)
 					for i, val := range qm {
-						if q.SubexpNames()[i] != "" {
-							groups[q.SubexpNames()[i]] = val
+						if tailFilenameRE.SubexpNames()[i] != "" {
+							groups[tailFilenameRE.SubexpNames()[i]] = val
 						}
 					}
 					subject.Filename = strings.Trim(groups["filename"], " -")
@@ -275,10 +393,158 @@ func ParseSubject(s string) (Subject, error) {
 		}
 	}
 
+	// some layouts leave the "yEnc" token preceding the filename or the numbers in the header
+	if header := headerYencRE.ReplaceAllString(subject.Header, ""); header != subject.Header {
+		subject.Header = header
+		if header == "" {
+			subject.Header = subject.Basefilename
+		}
+	}
+
+	subject.Remainder = leftover(tagged, subject)
+
 	return subject, nil
 
 }
 
+// returns the text of the remainder which is neither part of the header nor of the filename, without "yEnc" and the size
+func leftover(remainder string, subject Subject) string {
+	for _, part := range []string{subject.Filename, subject.Header} {
+		if part != "" {
+			remainder = strings.Replace(remainder, part, "", 1)
+		}
+	}
+
+	remainder = leftoverRE.ReplaceAllString(remainder, "")
+
+	return strings.Trim(strings.Join(strings.Fields(remainder), " "), " -")
+}
+
+// parses subjects which name several files, each with a quoted filename and its own segment numbers
+// e.g. [1/2] Header - "first.rar" yEnc (1/10) - "second.rar" yEnc (1/5)
+// every filename is parsed with ParseSubject together with the text before the first filename (header and file numbers),
+// the Subject field holds that part of the subject
+// subjects with less than two quoted filenames with known extensions return the result of ParseSubject as the only element
+func ParseSubjectMulti(s string) ([]Subject, error) {
+	s = strings.TrimSpace(s)
+
+	var starts []int
+
+	for _, m := range quotedStringRE.FindAllStringSubmatchIndex(s, -1) {
+		if c := candidateFilenameRE.FindStringSubmatch(strings.TrimSpace(s[m[2]:m[3]])); c != nil && isKnownExtension(c[2][strings.LastIndex(c[2], ".")+1:]) {
+			starts = append(starts, m[0])
+		}
+	}
+
+	if len(starts) < 2 {
+		subject, err := ParseSubject(s)
+		if err != nil {
+			return nil, err
+		}
+
+		return []Subject{subject}, nil
+	}
+
+	prefix := s[:starts[0]]
+	subjects := make([]Subject, 0, len(starts))
+
+	for i, start := range starts {
+		end := len(s)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+
+		subject, err := ParseSubject(prefix + s[start:end])
+		if err != nil {
+			return nil, err
+		}
+
+		subjects = append(subjects, subject)
+	}
+
+	return subjects, nil
+}
+
+// reconstructs a subject in the common format [X/Y] Header - "Filename" yEnc Size (X/Y)
+// the file numbers are omitted for single file posts, the header if it equals the basefilename and the size if it is unknown
+// the result parsed again by ParseSubject returns the same file and segment numbers, filename and size
+func (s Subject) String() string {
+	var b strings.Builder
+
+	if s.TotalFiles > 1 {
+		b.WriteString("[" + strconv.Itoa(s.File) + "/" + strconv.Itoa(s.TotalFiles) + "] ")
+	}
+
+	if s.Header != "" && s.Header != s.Basefilename {
+		b.WriteString(s.Header + " - ")
+	}
+
+	b.WriteString(`"` + s.Filename + `" yEnc`)
+
+	if s.Size > 0 {
+		b.WriteString(" " + strconv.FormatInt(s.Size, 10))
+	}
+
+	if s.TotalSegments > 0 {
+		b.WriteString(" (" + strconv.Itoa(s.Segment) + "/" + strconv.Itoa(s.TotalSegments) + ")")
+	}
+
+	return b.String()
+}
+
+// returns the season and episode numbers stated in the header as s03e07, 3x07 or season 3 episode 7
+// for multi episode ranges like s01e01e02 the first episode is returned, ok is false if no pattern matches
+func (s Subject) SeasonEpisode() (season, episode int, ok bool) {
+	for _, re := range []*regexp.Regexp{seasonEpisodeRE, seasonWordsRE, seasonXEpisodeRE} {
+		if m := re.FindStringSubmatch(s.Header); m != nil {
+			season, _ = strconv.Atoi(m[1])
+			episode, _ = strconv.Atoi(m[2])
+
+			return season, episode, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// returns the lowercased extension of the filename without the dot or an empty string if there is none
+// compound extensions return their last part (part01.rar and vol03+04.par2 become rar and par2, 7z.001 becomes 7z)
+func (s Subject) Extension() string {
+	return fileExtension(s.Filename, s.Basefilename)
+}
+
+// returns the lowercased extension of the filename, the part after the basefilename if it is a prefix
+// a filename equal to its basefilename has no extension
+func fileExtension(filename, basefilename string) string {
+	rest := filename
+
+	if basefilename != "" {
+		if basefilename == filename {
+			return ""
+		}
+
+		if strings.HasPrefix(filename, basefilename) {
+			rest = filename[len(basefilename):]
+		}
+	}
+
+	if splitSevenZipRE.MatchString(rest) {
+		return "7z"
+	}
+
+	idx := strings.LastIndex(rest, ".")
+	if idx == -1 {
+		return ""
+	}
+
+	ext := strings.ToLower(rest[idx+1:])
+	if strings.ContainsAny(ext, " \"") {
+		return ""
+	}
+
+	return ext
+}
+
 // helper function for easier handling of named sub matches
 func findAllNamedMatches(regex *regexp.Regexp, str string) map[int]map[string]string {
 	matches := regex.FindAllStringSubmatch(str, -1)
@@ -296,3 +562,66 @@ func findAllNamedMatches(regex *regexp.Regexp, str string) map[int]map[string]st
 	}
 	return results
 }
+
+// concurrency-safe cache of parsed subjects, shared between parses with ParseOptions.SubjectCache
+// the zero value is ready to use, the cache is never evicted so it grows with every distinct subject
+type SubjectCache struct {
+	subjects sync.Map // subject string to Subject
+}
+
+// returns the parsed subject, parsing it only on the first call for the subject
+func (c *SubjectCache) Get(subject string) Subject {
+	parsed, _ := c.parse(subject)
+	return parsed
+}
+
+// parse the subject with the cache, a nil cache parses every subject
+func (c *SubjectCache) parse(subject string) (Subject, error) {
+	if c == nil {
+		return ParseSubject(subject)
+	}
+
+	if parsed, ok := c.subjects.Load(subject); ok {
+		return parsed.(Subject), nil
+	}
+
+	parsed, err := ParseSubject(subject)
+	if err != nil {
+		return parsed, err
+	}
+
+	c.subjects.Store(subject, parsed)
+
+	return parsed, nil
+}
+
+// returns the parsed subject of each file in the order of the files
+// files whose subject fails to parse get a Subject with only the full subject set
+// the parsed subjects are cached with the nzb, only subjects changed since the last call are parsed again
+func (n *Nzb) Subjects() []Subject {
+	c := n.cache()
+
+	c.subjectsMu.Lock()
+	defer c.subjectsMu.Unlock()
+
+	if len(c.subjects) != len(n.Files) {
+		c.subjects = slices.Grow(c.subjects[:0], len(n.Files))[:len(n.Files)]
+		c.rawSubjects = slices.Grow(c.rawSubjects[:0], len(n.Files))[:len(n.Files)]
+	}
+
+	for id := range n.Files {
+		// the parsed subject is trimmed, so it is compared by the subject it was parsed from
+		// the zero value doesn't match a non-empty subject, so new entries are parsed as well
+		if cached := &c.subjects[id]; c.rawSubjects[id] != n.Files[id].Subject || cached.Subject == "" {
+			parsed, err := ParseSubject(n.Files[id].Subject)
+			if err != nil {
+				parsed = Subject{Subject: n.Files[id].Subject}
+			}
+
+			*cached = parsed
+			c.rawSubjects[id] = n.Files[id].Subject
+		}
+	}
+
+	return slices.Clone(c.subjects)
+}
@@ -1,95 +1,158 @@
 package nzbparser
 
-import "testing"
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// test cases of the subject parser
+var subjectCases = []struct {
+	name   string
+	input  string
+	header string
+	fname  string
+	base   string
+	file   int
+	totalF int
+	seg    int
+	totalS int
+}{
+	{
+		name:   "unicode and hyphenated suffix mkv",
+		input:  `Volt.Test.Smth.Lui.2008.1080p.BluRay.Remux.AVC.Multi.VFF.DTS.5.1.DTS-HD.MA.5.1-TEST.mkv`,
+		header: "Volt.Test.Smth.Lui.2008.1080p.BluRay.Remux.AVC.Multi.VFF.DTS.5.1.DTS-HD.MA.5.1-TEST",
+		fname:  "Volt.Test.Smth.Lui.2008.1080p.BluRay.Remux.AVC.Multi.VFF.DTS.5.1.DTS-HD.MA.5.1-TEST.mkv",
+		base:   "Volt.Test.Smth.Lui.2008.1080p.BluRay.Remux.AVC.Multi.VFF.DTS.5.1.DTS-HD.MA.5.1-TEST",
+		file:   1, totalF: 1, seg: 1, totalS: 1,
+	},
+	{
+		name:   "dual quoted release + r00",
+		input:  `[04/23] "Lili.en.Marleen.S03E07.FLEMISH.1080p.WEB.h264-TRIPEL" - "lili.en.marleen.s03e07.flemish.1080p.web.h264-tripel.r00" - yEnc(1/140)`,
+		header: "Lili.en.Marleen.S03E07.FLEMISH.1080p.WEB.h264-TRIPEL",
+		fname:  "lili.en.marleen.s03e07.flemish.1080p.web.h264-tripel.r00",
+		base:   "lili.en.marleen.s03e07.flemish.1080p.web.h264-tripel",
+		file:   4, totalF: 23, seg: 1, totalS: 140,
+	},
+	{
+		name:   "simple with brackets and paren",
+		input:  `[1/2] Test Subject - "test.txt" yEnc (1/2)`,
+		header: "Test Subject",
+		fname:  "test.txt",
+		base:   "test",
+		file:   1, totalF: 2, seg: 1, totalS: 2,
+	},
+	{
+		name:   "single file no numbers",
+		input:  `"singlefile.nfo" yEnc (1/1)`,
+		header: "singlefile",
+		fname:  "singlefile.nfo",
+		base:   "singlefile",
+		file:   1, totalF: 1, seg: 1, totalS: 1,
+	},
+	{
+		name:   "archive part with segment only",
+		input:  `Some Header - "archive.part01.rar" yEnc (12/120)`,
+		header: "Some Header",
+		fname:  "archive.part01.rar",
+		base:   "archive",
+		file:   1, totalF: 1, seg: 12, totalS: 120,
+	},
+	{
+		name:   "of pattern for files",
+		input:  `[ 5 of 12 ] "Example.txt" yEnc (1/1)`,
+		header: "Example",
+		fname:  "Example.txt",
+		base:   "Example",
+		file:   5, totalF: 12, seg: 1, totalS: 1,
+	},
+	{
+		name:   "both bracket pairs used (second are segments)",
+		input:  `[003/120] [03/140] "Release.Name.r03" yEnc`,
+		header: "Release.Name",
+		fname:  "Release.Name.r03",
+		base:   "Release.Name",
+		file:   3, totalF: 120, seg: 3, totalS: 140,
+	},
+	{
+		name:   "bracket-enclosed filename with empty quotes",
+		input:  `[PRiVATE]-[WtFnZb]-[het.smthign.s09e44.dutch.1080p.web.h264-test.r10]-[13/21] - "" yEnc  100000000 (1/140)`,
+		header: "het.smthign.s09e44.dutch.1080p.web.h264-test",
+		fname:  "het.smthign.s09e44.dutch.1080p.web.h264-test.r10",
+		base:   "het.smthign.s09e44.dutch.1080p.web.h264-test",
+		file:   13, totalF: 21, seg: 1, totalS: 140,
+	},
+	{
+		name:   "three leading tags before the bracket-enclosed filename",
+		input:  `[PRiVATE]-[WtFnZb]-[Tag3]-[het.smthign.s09e44.dutch.1080p.web.h264-test.r10]-[13/21] - "" yEnc (1/140)`,
+		header: "het.smthign.s09e44.dutch.1080p.web.h264-test",
+		fname:  "het.smthign.s09e44.dutch.1080p.web.h264-test.r10",
+		base:   "het.smthign.s09e44.dutch.1080p.web.h264-test",
+		file:   13, totalF: 21, seg: 1, totalS: 140,
+	},
+	{
+		name:   "two leading tags before the bracket-enclosed filename without numbers",
+		input:  `[PRiVATE]-[WtFnZb]-[het.smthign.s09e44.dutch.1080p.web.h264-test.mkv] yEnc (1/10)`,
+		header: "het.smthign.s09e44.dutch.1080p.web.h264-test",
+		fname:  "het.smthign.s09e44.dutch.1080p.web.h264-test.mkv",
+		base:   "het.smthign.s09e44.dutch.1080p.web.h264-test",
+		file:   1, totalF: 1, seg: 1, totalS: 10,
+	},
+	{
+		name:   "three leading tags before the quoted filename",
+		input:  `[PRiVATE]-[WtFnZb]-[Tag3]-[2/5] - "het.smthign.s09e44.part02.rar" yEnc (1/30)`,
+		header: "het.smthign.s09e44",
+		fname:  "het.smthign.s09e44.part02.rar",
+		base:   "het.smthign.s09e44",
+		file:   2, totalF: 5, seg: 1, totalS: 30,
+	},
+	{
+		name:   "unquoted filename with multiple dots and mkv extension",
+		input:  `Test S01E02 ATVP WEB-DL 1080p DDP5.1 Atmos H264-something.mkv (1/0)`,
+		header: "Test S01E02 ATVP WEB-DL 1080p DDP5.1 Atmos H264-something",
+		fname:  "Test S01E02 ATVP WEB-DL 1080p DDP5.1 Atmos H264-something.mkv",
+		base:   "Test S01E02 ATVP WEB-DL 1080p DDP5.1 Atmos H264-something",
+		file:   1, totalF: 1, seg: 1, totalS: 1, // (1/0) is malformed, parser defaults to 1/1
+	},
+	{
+		name:   "unquoted filename with an extension in the middle",
+		input:  `My Release Group presents file.name.here.mkv more junk`,
+		header: "My Release Group presents",
+		fname:  "file.name.here.mkv",
+		base:   "file.name.here",
+		file:   1, totalF: 1, seg: 1, totalS: 1,
+	},
+	{
+		name:   "unquoted filename in the middle with numbers",
+		input:  `[2/5] Group - release.web.DTS.5.1-x.part02.rar yEnc (1/30)`,
+		header: "Group",
+		fname:  "release.web.DTS.5.1-x.part02.rar",
+		base:   "release.web.DTS.5.1-x.part02",
+		file:   2, totalF: 5, seg: 1, totalS: 30,
+	},
+	{
+		name:   "unquoted filename with spaces",
+		input:  `Some Movie 2020.mkv yEnc (1/50)`,
+		header: "Some Movie 2020",
+		fname:  "Some Movie 2020.mkv",
+		base:   "Some Movie 2020",
+		file:   1, totalF: 1, seg: 1, totalS: 50,
+	},
+	{
+		name:   "unquoted episode filename with spaces",
+		input:  `Show Name S01E01 1080p.mkv yEnc (1/5)`,
+		header: "Show Name S01E01 1080p",
+		fname:  "Show Name S01E01 1080p.mkv",
+		base:   "Show Name S01E01 1080p",
+		file:   1, totalF: 1, seg: 1, totalS: 5,
+	},
+}
 
 // Dedicated tests for the Subject parser
 func TestParseSubject(t *testing.T) {
-	cases := []struct {
-		name   string
-		input  string
-		header string
-		fname  string
-		base   string
-		file   int
-		totalF int
-		seg    int
-		totalS int
-	}{
-		{
-			name:   "unicode and hyphenated suffix mkv",
-			input:  `Volt.Test.Smth.Lui.2008.1080p.BluRay.Remux.AVC.Multi.VFF.DTS.5.1.DTS-HD.MA.5.1-TEST.mkv`,
-			header: "Volt.Test.Smth.Lui.2008.1080p.BluRay.Remux.AVC.Multi.VFF.DTS.5.1.DTS-HD.MA.5.1-TEST",
-			fname:  "Volt.Test.Smth.Lui.2008.1080p.BluRay.Remux.AVC.Multi.VFF.DTS.5.1.DTS-HD.MA.5.1-TEST.mkv",
-			base:   "Volt.Test.Smth.Lui.2008.1080p.BluRay.Remux.AVC.Multi.VFF.DTS.5.1.DTS-HD.MA.5.1-TEST",
-			file:   1, totalF: 1, seg: 1, totalS: 1,
-		},
-		{
-			name:   "dual quoted release + r00",
-			input:  `[04/23] "Lili.en.Marleen.S03E07.FLEMISH.1080p.WEB.h264-TRIPEL" - "lili.en.marleen.s03e07.flemish.1080p.web.h264-tripel.r00" - yEnc(1/140)`,
-			header: "Lili.en.Marleen.S03E07.FLEMISH.1080p.WEB.h264-TRIPEL",
-			fname:  "lili.en.marleen.s03e07.flemish.1080p.web.h264-tripel.r00",
-			base:   "lili.en.marleen.s03e07.flemish.1080p.web.h264-tripel",
-			file:   4, totalF: 23, seg: 1, totalS: 140,
-		},
-		{
-			name:   "simple with brackets and paren",
-			input:  `[1/2] Test Subject - "test.txt" yEnc (1/2)`,
-			header: "Test Subject",
-			fname:  "test.txt",
-			base:   "test",
-			file:   1, totalF: 2, seg: 1, totalS: 2,
-		},
-		{
-			name:   "single file no numbers",
-			input:  `"singlefile.nfo" yEnc (1/1)`,
-			header: "singlefile",
-			fname:  "singlefile.nfo",
-			base:   "singlefile",
-			file:   1, totalF: 1, seg: 1, totalS: 1,
-		},
-		{
-			name:   "archive part with segment only",
-			input:  `Some Header - "archive.part01.rar" yEnc (12/120)`,
-			header: "Some Header",
-			fname:  "archive.part01.rar",
-			base:   "archive",
-			file:   1, totalF: 1, seg: 12, totalS: 120,
-		},
-		{
-			name:   "of pattern for files",
-			input:  `[ 5 of 12 ] "Example.txt" yEnc (1/1)`,
-			header: "Example",
-			fname:  "Example.txt",
-			base:   "Example",
-			file:   5, totalF: 12, seg: 1, totalS: 1,
-		},
-		{
-			name:   "both bracket pairs used (second are segments)",
-			input:  `[003/120] [03/140] "Release.Name.r03" yEnc`,
-			header: "Release.Name",
-			fname:  "Release.Name.r03",
-			base:   "Release.Name",
-			file:   3, totalF: 120, seg: 3, totalS: 140,
-		},
-		{
-			name:   "bracket-enclosed filename with empty quotes",
-			input:  `[PRiVATE]-[WtFnZb]-[het.smthign.s09e44.dutch.1080p.web.h264-test.r10]-[13/21] - "" yEnc  100000000 (1/140)`,
-			header: "het.smthign.s09e44.dutch.1080p.web.h264-test",
-			fname:  "het.smthign.s09e44.dutch.1080p.web.h264-test.r10",
-			base:   "het.smthign.s09e44.dutch.1080p.web.h264-test",
-			file:   13, totalF: 21, seg: 1, totalS: 140,
-		},
-		{
-			name:   "unquoted filename with multiple dots and mkv extension",
-			input:  `Test S01E02 ATVP WEB-DL 1080p DDP5.1 Atmos H264-something.mkv (1/0)`,
-			header: "Test S01E02 ATVP WEB-DL 1080p DDP5.1 Atmos H264-something",
-			fname:  "Test S01E02 ATVP WEB-DL 1080p DDP5.1 Atmos H264-something.mkv",
-			base:   "Test S01E02 ATVP WEB-DL 1080p DDP5.1 Atmos H264-something",
-			file:   1, totalF: 1, seg: 1, totalS: 1, // (1/0) is malformed, parser defaults to 1/1
-		},
-	}
-
-	for _, c := range cases {
+	for _, c := range subjectCases {
 		parsed, err := ParseSubject(c.input)
 		if err != nil {
 			t.Fatalf("%s: unexpected error: %v", c.name, err)
@@ -111,3 +174,493 @@ func TestParseSubject(t *testing.T) {
 		}
 	}
 }
+
+func TestSubjectString(t *testing.T) {
+	add := []string{
+		`[1/2] Test Subject - "test.txt" yEnc 12345 (1/2)`,
+	}
+
+	inputs := make([]string, 0, len(subjectCases)+len(add))
+	for _, c := range subjectCases {
+		inputs = append(inputs, c.input)
+	}
+	inputs = append(inputs, add...)
+
+	for _, input := range inputs {
+		parsed, err := ParseSubject(input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", input, err)
+		}
+
+		s := parsed.String()
+
+		again, err := ParseSubject(s)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", s, err)
+		}
+		if again.File != parsed.File || again.TotalFiles != parsed.TotalFiles {
+			t.Errorf("%q: file numbers got %d/%d want %d/%d", s, again.File, again.TotalFiles, parsed.File, parsed.TotalFiles)
+		}
+		if again.Segment != parsed.Segment || again.TotalSegments != parsed.TotalSegments {
+			t.Errorf("%q: segment numbers got %d/%d want %d/%d", s, again.Segment, again.TotalSegments, parsed.Segment, parsed.TotalSegments)
+		}
+		if again.Filename != parsed.Filename {
+			t.Errorf("%q: filename got %q want %q", s, again.Filename, parsed.Filename)
+		}
+		if again.Header != parsed.Header {
+			t.Errorf("%q: header got %q want %q", s, again.Header, parsed.Header)
+		}
+		if again.Size != parsed.Size {
+			t.Errorf("%q: size got %d want %d", s, again.Size, parsed.Size)
+		}
+	}
+
+	subject := Subject{Header: "Release", Filename: "release.rar", Basefilename: "release", File: 2, TotalFiles: 5, Segment: 3, TotalSegments: 10}
+	if s := subject.String(); s != `[2/5] Release - "release.rar" yEnc (3/10)` {
+		t.Errorf("Unexpected subject %q", s)
+	}
+
+	subject = Subject{Header: "single", Filename: "single.nfo", Basefilename: "single", File: 1, TotalFiles: 1, Segment: 1, TotalSegments: 1}
+	if s := subject.String(); s != `"single.nfo" yEnc (1/1)` {
+		t.Errorf("Unexpected subject %q", s)
+	}
+}
+
+func TestSeasonEpisode(t *testing.T) {
+	cases := []struct {
+		header  string
+		season  int
+		episode int
+		ok      bool
+	}{
+		{"show.s03e07.1080p.web.h264-group", 3, 7, true},
+		{"Show S01E02 ATVP WEB-DL 1080p", 1, 2, true},
+		{"show_s10e101_720p", 10, 101, true},
+		{"show.s01e01e02.1080p", 1, 1, true},
+		{"Show 3x07 HDTV", 3, 7, true},
+		{"Show Season 2 Episode 11", 2, 11, true},
+		{"show.season.02.episode.03", 2, 3, true},
+		{"Movie.2008.1080p.BluRay.x264-GROUP", 0, 0, false},
+		{"Movie 1920x1080 Remux", 0, 0, false},
+		{"", 0, 0, false},
+	}
+
+	for _, c := range cases {
+		season, episode, ok := Subject{Header: c.header}.SeasonEpisode()
+		if season != c.season || episode != c.episode || ok != c.ok {
+			t.Errorf("%q: got %d, %d, %v want %d, %d, %v", c.header, season, episode, ok, c.season, c.episode, c.ok)
+		}
+	}
+}
+
+func TestSubjectExtension(t *testing.T) {
+	cases := []struct {
+		input string
+		ext   string
+	}{
+		{`[1/2] Test Subject - "test.TXT" yEnc (1/2)`, "txt"},
+		{`Some Header - "archive.part01.rar" yEnc (12/120)`, "rar"},
+		{`[3/9] "release.vol03+04.par2" yEnc (1/1)`, "par2"},
+		{`[1/9] "release.7z.001" yEnc (1/1)`, "7z"},
+		{`[003/120] [03/140] "Release.Name.r03" yEnc`, "r03"},
+		{`Test S01E02 ATVP WEB-DL 1080p DDP5.1 Atmos H264-something.mkv (1/0)`, "mkv"},
+		{`[1/1] "README" yEnc (1/1)`, ""},
+		{`no filename at all`, ""},
+	}
+
+	for _, c := range cases {
+		parsed, err := ParseSubject(c.input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", c.input, err)
+		}
+		if ext := parsed.Extension(); ext != c.ext {
+			t.Errorf("%q: extension got %q want %q", c.input, ext, c.ext)
+		}
+	}
+}
+
+func TestParseSubjectSize(t *testing.T) {
+	cases := []struct {
+		input string
+		size  int64
+	}{
+		{`[PRiVATE]-[WtFnZb]-[het.smthign.s09e44.dutch.1080p.web.h264-test.r10]-[13/21] - "" yEnc  100000000 (1/140)`, 100000000},
+		{`[1/2] Test Subject - "test.txt" yEnc 12345 (1/2)`, 12345},
+		{`[1/2] Test Subject - "test.txt" YENC 12345`, 12345},
+		{`[1/2] Test Subject - "test.txt" yEnc (1/2)`, 0},
+		{`[1/2] Test Subject - "test.txt" yEnc(1/2) 12345`, 0},
+		{`Test Subject - "test.txt" yEnc [1/2]`, 0},
+		{`Test Subject - "test.txt" yEnc 1/2`, 0},
+	}
+
+	for _, c := range cases {
+		parsed, err := ParseSubject(c.input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", c.input, err)
+		}
+		if parsed.Size != c.size {
+			t.Errorf("%q: size got %d want %d", c.input, parsed.Size, c.size)
+		}
+	}
+}
+
+func TestSubjectRemainder(t *testing.T) {
+	cases := []struct {
+		input     string
+		remainder string
+	}{
+		{`"singlefile.nfo" yEnc (1/1)`, ""},
+		{`[1/2] Test Subject - "test.txt" yEnc 12345 (1/2)`, ""},
+		{`[04/23] "Lili.en.Marleen.S03E07.FLEMISH.1080p.WEB.h264-TRIPEL" - "lili.en.marleen.s03e07.flemish.1080p.web.h264-tripel.r00" - yEnc(1/140)`, ""},
+		{`[PRiVATE]-[WtFnZb]-[Tag3]-[2/5] - "het.smthign.s09e44.part02.rar" yEnc (1/30)`, "[PRiVATE]-[WtFnZb]-[Tag3]"},
+		{`My Release Group presents file.name.here.mkv more junk`, "more junk"},
+	}
+
+	for _, c := range cases {
+		parsed, err := ParseSubject(c.input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", c.input, err)
+		}
+		if parsed.Remainder != c.remainder {
+			t.Errorf("%q: remainder got %q want %q", c.input, parsed.Remainder, c.remainder)
+		}
+	}
+}
+
+func TestSubjectHeaderYenc(t *testing.T) {
+	cases := []struct {
+		input  string
+		header string
+	}{
+		{`Release Name yEnc - "file.rar" (1/2)`, "Release Name"},
+		{`Release Name - (yEnc) "file.rar" (1/2)`, "Release Name"},
+		{`[1/5] Release Name - YENC - "file.rar" (1/2)`, "Release Name"},
+		{`Release Name yenc 12345 "file.rar" (1/2)`, "Release Name"},
+		{`yEnc "file.rar" (1/2)`, "file"},
+		{`Some Release yEnc (1/1)`, "Some Release"},
+		// the token is kept within words and names
+		{`My yEncoder Release - "file.rar" yEnc (1/2)`, "My yEncoder Release"},
+		{`Tools - yEnc Release Kit - "file.rar" yEnc (1/2)`, "Tools - yEnc Release Kit"},
+		{`Release.yEnc - "file.rar" (1/2)`, "Release.yEnc"},
+	}
+
+	for _, c := range cases {
+		parsed, err := ParseSubject(c.input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", c.input, err)
+		}
+		if parsed.Header != c.header {
+			t.Errorf("%q: header got %q want %q", c.input, parsed.Header, c.header)
+		}
+		if parsed.Remainder != "" {
+			t.Errorf("%q: expected no remainder, got %q", c.input, parsed.Remainder)
+		}
+	}
+}
+
+func TestParseSubjectMulti(t *testing.T) {
+	subjects, err := ParseSubjectMulti(`[1/2] Header - "first.rar" yEnc (3/10) - "second.par2" yEnc (1/5)`)
+	if err != nil {
+		t.Fatalf("ParseSubjectMulti failed: %v", err)
+	}
+
+	if len(subjects) != 2 {
+		t.Fatalf("Expected 2 subjects, got %+v", subjects)
+	}
+
+	expected := []struct {
+		fname  string
+		seg    int
+		totalS int
+	}{
+		{"first.rar", 3, 10},
+		{"second.par2", 1, 5},
+	}
+
+	for i, e := range expected {
+		got := subjects[i]
+		if got.Filename != e.fname || got.Segment != e.seg || got.TotalSegments != e.totalS {
+			t.Errorf("%d: expected %s (%d/%d), got %s (%d/%d)", i, e.fname, e.seg, e.totalS, got.Filename, got.Segment, got.TotalSegments)
+		}
+
+		if got.Header != "Header" || got.File != 1 || got.TotalFiles != 2 {
+			t.Errorf("%d: expected the header and file numbers of the subject, got %q [%d/%d]", i, got.Header, got.File, got.TotalFiles)
+		}
+	}
+
+	// single file subjects, including a release name before the filename, give the result of ParseSubject
+	for _, c := range subjectCases {
+		subjects, err := ParseSubjectMulti(c.input)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+
+		expected, _ := ParseSubject(c.input)
+		if len(subjects) != 1 || subjects[0] != expected {
+			t.Errorf("%s: expected %+v, got %+v", c.name, expected, subjects)
+		}
+	}
+}
+
+func TestSubjectFileBeyondTotal(t *testing.T) {
+	parsed, err := ParseSubject(`[30/23] Release - "release.part30.rar" yEnc (1/10)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if parsed.File != 30 || parsed.TotalFiles < parsed.File || !parsed.Corrected {
+		t.Errorf("Expected file 30 with a corrected total of at least 30, got %+v", parsed)
+	}
+
+	parsed, _ = ParseSubject(`[23/30] Release - "release.part23.rar" yEnc (1/10)`)
+	if parsed.File != 23 || parsed.TotalFiles != 30 || parsed.Corrected {
+		t.Errorf("Expected file 23 of 30 without correction, got %+v", parsed)
+	}
+
+	// the nzb total follows the corrected subject
+	nzb := &Nzb{Files: []NzbFile{{Subject: `[30/23] Release - "release.part30.rar" yEnc (1/1)`}}}
+	ScanNzbFile(nzb)
+
+	if nzb.TotalFiles < nzb.Files[0].Number {
+		t.Errorf("Expected a total of at least %d files, got %d", nzb.Files[0].Number, nzb.TotalFiles)
+	}
+}
+
+func TestMaxSubjectTotal(t *testing.T) {
+	cases := []struct {
+		input  string
+		totalF int
+		seg    int
+		totalS int
+	}{
+		{`"file.rar" yEnc (1/999999999999)`, 1, 1, 1},
+		{`"file.rar" yEnc (5/99999999999999999999999)`, 1, 1, 1},
+		{`[1/99999999999999999999999] "file.rar" yEnc (1/2)`, 1, 1, 2},
+		{`[1/100001] "file.rar" yEnc (1/2)`, 1, 1, 2},
+		{`[1/100000] "file.rar" yEnc (2/100000)`, 100000, 2, 100000},
+	}
+
+	for _, c := range cases {
+		parsed, err := ParseSubject(c.input)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", c.input, err)
+		}
+		if parsed.TotalFiles != c.totalF || parsed.Segment != c.seg || parsed.TotalSegments != c.totalS {
+			t.Errorf("%q: got %d files and segment %d/%d, want %d files and segment %d/%d", c.input, parsed.TotalFiles, parsed.Segment, parsed.TotalSegments, c.totalF, c.seg, c.totalS)
+		}
+		if parsed.File < 0 || parsed.Segment < 0 {
+			t.Errorf("%q: expected no negative numbers, got %+v", c.input, parsed)
+		}
+	}
+
+	// the maximum is configurable
+	limit := MaxSubjectTotal
+	defer func() { MaxSubjectTotal = limit }()
+
+	MaxSubjectTotal = 10
+
+	if parsed, _ := ParseSubject(`"file.rar" yEnc (1/11)`); parsed.TotalSegments != 1 {
+		t.Errorf("Expected the total above the maximum to be unknown, got %d", parsed.TotalSegments)
+	}
+
+	// the huge total doesn't reach the file
+	MaxSubjectTotal = limit
+
+	nzb, err := ParseString(`<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="poster" date="1" subject="&quot;file.rar&quot; yEnc (1/999999999999)">
+    <groups><group>alt.test</group></groups>
+    <segments><segment bytes="100" number="2">a@test</segment></segments>
+  </file>
+</nzb>`)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if nzb.Files[0].TotalSegments != 2 || len(nzb.Files[0].MissingSegments()) != 1 {
+		t.Errorf("Expected the segment numbers of the file to be used, got %d total segments", nzb.Files[0].TotalSegments)
+	}
+
+	// the segment numbers of the nzb are not limited, MissingSegments still reports at most MaxSubjectTotal numbers
+	nzb, err = ParseString(`<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <file poster="poster" date="1" subject="&quot;file.rar&quot; yEnc (1/2)">
+    <groups><group>alt.test</group></groups>
+    <segments>
+      <segment bytes="100" number="1">a@test</segment>
+      <segment bytes="100" number="999999999">b@test</segment>
+    </segments>
+  </file>
+</nzb>`)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if file := nzb.Files[0]; file.TotalSegments != 999999999 || len(file.MissingSegments()) != MaxSubjectTotal+1 {
+		t.Errorf("Expected the huge segment number as total, got %d total segments", file.TotalSegments)
+	}
+
+	// a file with more segments than MaxSubjectTotal keeps its total
+	MaxSubjectTotal = 10
+
+	file := NzbFile{Subject: `"file.rar" yEnc`}
+	for number := 1; number <= 15; number++ {
+		if number != 13 && number != 14 {
+			file.Segments = append(file.Segments, NzbSegment{Number: number, Bytes: 100, ID: fmt.Sprintf("%d@test", number)})
+		}
+	}
+
+	nzb = &Nzb{Files: NzbFiles{file}}
+	ScanNzbFile(nzb)
+
+	if nzb.TotalSegments != 15 || nzb.IsComplete() || !reflect.DeepEqual(nzb.Files[0].MissingSegments(), []int{13, 14}) {
+		t.Errorf("Expected 15 total segments with 13 and 14 missing, got %d (%v)", nzb.TotalSegments, nzb.Files[0].MissingSegments())
+	}
+}
+
+func TestRegisterExtension(t *testing.T) {
+	input := `[1/1] "Release.Name.2024" - "image.iso" yEnc (1/1)`
+
+	parsed, err := ParseSubject(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.Filename != "Release.Name.2024" {
+		t.Errorf("unregistered extension: filename got %q want %q", parsed.Filename, "Release.Name.2024")
+	}
+
+	RegisterExtension(".ISO")
+	defer delete(KnownExtensions, "iso")
+
+	if _, ok := KnownExtensions["iso"]; !ok {
+		t.Fatal("expected iso to be registered")
+	}
+
+	parsed, err = ParseSubject(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if parsed.Filename != "image.iso" || parsed.Basefilename != "image" || parsed.Header != "Release.Name.2024" {
+		t.Errorf("registered extension: got header %q filename %q basefilename %q", parsed.Header, parsed.Filename, parsed.Basefilename)
+	}
+}
+
+func BenchmarkParseSubject(b *testing.B) {
+	subjects := []string{
+		`[04/23] "Lili.en.Marleen.S03E07.FLEMISH.1080p.WEB.h264-TRIPEL" - "lili.en.marleen.s03e07.flemish.1080p.web.h264-tripel.r00" - yEnc(1/140)`,
+		`[1/2] Test Subject - "test.txt" yEnc (1/2)`,
+		`[PRiVATE]-[WtFnZb]-[het.smthign.s09e44.dutch.1080p.web.h264-test.r10]-[13/21] - "" yEnc  100000000 (1/140)`,
+		`Test S01E02 ATVP WEB-DL 1080p DDP5.1 Atmos H264-something.mkv (1/0)`,
+	}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		for _, s := range subjects {
+			if _, err := ParseSubject(s); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestSubjectCache(t *testing.T) {
+	cache := new(SubjectCache)
+
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for _, c := range subjectCases {
+				expected, _ := ParseSubject(c.input)
+				if got := cache.Get(c.input); got != expected {
+					t.Errorf("%s: cached subject %+v differs from %+v", c.name, got, expected)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// parsing with the cache gives the same result
+	expected, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		nzb, err := ParseWithOptions(strings.NewReader(streamTestNZB), ParseOptions{RemoveDuplicates: true, SubjectCache: cache})
+		if err != nil {
+			t.Fatalf("ParseWithOptions failed: %v", err)
+		}
+
+		if !reflect.DeepEqual(nzb, expected) {
+			t.Errorf("Expected the cached parse to equal the uncached one, got %+v", nzb)
+		}
+	}
+
+	// a nil cache parses the subject
+	var empty *SubjectCache
+	if got := empty.Get(subjectCases[0].input); got.Filename != subjectCases[0].fname {
+		t.Errorf("Expected a nil cache to parse the subject, got %+v", got)
+	}
+}
+
+func TestNzbSubjects(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: `[1/2] "file.part1.rar" yEnc (1/10)`},
+			{Subject: `[2/2] "file.part2.rar" yEnc (1/10)`},
+		},
+	}
+
+	subjects := nzb.Subjects()
+	if len(subjects) != 2 || subjects[0].Filename != "file.part1.rar" || subjects[1].File != 2 {
+		t.Fatalf("Unexpected subjects: %+v", subjects)
+	}
+
+	// the returned slice is a copy of the cache
+	subjects[0].Filename = "changed"
+	if got := nzb.Subjects()[0].Filename; got != "file.part1.rar" {
+		t.Errorf("Expected the cached subject to be unchanged, got %q", got)
+	}
+
+	// changed and added files are parsed again
+	nzb.Files[1].Subject = `[2/3] "file.part2.rar" yEnc (1/10)`
+	nzb.Files = append(nzb.Files, NzbFile{Subject: `[3/3] "file.par2" yEnc (1/1)`})
+
+	subjects = nzb.Subjects()
+	if len(subjects) != 3 || subjects[1].TotalFiles != 3 || subjects[2].Filename != "file.par2" {
+		t.Errorf("Unexpected subjects after changing the files: %+v", subjects)
+	}
+
+	expected, _ := ParseSubject(nzb.Files[0].Subject)
+
+	nzb.Files = nzb.Files[:1]
+	if subjects := nzb.Subjects(); len(subjects) != 1 || !reflect.DeepEqual(subjects[0], expected) {
+		t.Errorf("Unexpected subjects after removing files: %+v", subjects)
+	}
+}
+
+func TestNzbSubjectsPadded(t *testing.T) {
+	nzb := &Nzb{Files: []NzbFile{{Subject: `  [1/1] "file.rar" yEnc (1/10)  `}}}
+
+	subjects := nzb.Subjects()
+	if len(subjects) != 1 || subjects[0].Filename != "file.rar" || subjects[0].Subject == nzb.Files[0].Subject {
+		t.Fatalf("Unexpected subjects: %+v", subjects)
+	}
+
+	// the padded subject is served from the cache instead of being parsed again
+	nzb.cache().subjects[0].Filename = "cached"
+	if got := nzb.Subjects()[0].Filename; got != "cached" {
+		t.Errorf("Expected the cached subject of the padded subject, got %q", got)
+	}
+
+	// a change of the padding only is still noticed
+	nzb.Files[0].Subject = `[1/1] "file.rar" yEnc (1/10)`
+	if got := nzb.Subjects()[0].Filename; got != "file.rar" {
+		t.Errorf("Expected the changed subject to be parsed again, got %q", got)
+	}
+}
@@ -0,0 +1,222 @@
+package nzbparser
+
+import (
+	"sort"
+)
+
+// merge multiple nzbs into a new one
+// files are concatenated in the given order, deduplicated like MakeUnique, scanned and sorted like Parse
+// the positions of the files are renumbered in the order of the concatenation for WriteOptions.PreserveInputOrder
+// meta data is united with later nzbs overwriting the values of earlier ones for the same type
+// the comment of the first nzb with a non-empty comment is kept
+// nil nzbs are skipped and the input nzbs are left untouched
+func Merge(nzbs ...*Nzb) *Nzb {
+	merged := &Nzb{
+		Meta:      make(map[string]string),
+		MetaMulti: make(map[string][]string),
+	}
+
+	offset := 0 // highest file position of the merged nzbs
+
+	for _, nzb := range nzbs {
+		if nzb == nil {
+			continue
+		}
+
+		if merged.Comment == "" {
+			merged.Comment = nzb.Comment
+		}
+
+		for key, value := range nzb.Meta {
+			merged.Meta[key] = value
+			delete(merged.MetaMulti, key)
+		}
+
+		for key, values := range nzb.MetaMulti {
+			merged.MetaMulti[key] = append([]string(nil), values...)
+		}
+
+		// the positions of the files continue those of the previous nzbs
+		start := len(merged.Files)
+		merged.Files = append(merged.Files, nzb.Files...)
+
+		last := offset
+		for id := start; id < len(merged.Files); id++ {
+			if merged.Files[id].position > 0 {
+				merged.Files[id].position = merged.Files[id].position + offset
+				last = max(last, merged.Files[id].position)
+			}
+		}
+
+		offset = last
+	}
+
+	// the message-ids of the inputs are already clean, so they are not unescaped again
+	MakeUnique(merged)
+	scanNzb(merged)
+
+	sort.Stable(merged.Files)
+
+	for id := range merged.Files {
+		sort.Stable(merged.Files[id].Segments)
+	}
+
+	return merged
+}
+
+// keep only the files for which keep returns true and rescan the nzb so the totals reflect the reduced set
+// the file numbers are left as they are, so they may have gaps afterwards
+func (n *Nzb) Filter(keep func(NzbFile) bool) {
+	kept := n.Files[:0]
+
+	for _, file := range n.Files {
+		if keep(file) {
+			kept = append(kept, file)
+		}
+	}
+
+	n.Files = kept
+
+	scanNzb(n)
+}
+
+// remove all par2 recovery files (name.par2, name.vol03+04.par2) from the nzb
+// like Filter the file numbers are left as they are
+func (n *Nzb) RemovePar2() {
+	n.Filter(func(file NzbFile) bool {
+		return !file.IsPar2()
+	})
+}
+
+// number the files 1..N in their current order and set TotalFiles to the number of files
+// useful after Filter or RemovePar2 left gaps, the subjects and segments are left untouched
+// note that a rescan (e.g. ScanNzbFile) takes the file numbers from the subjects again
+func (n *Nzb) Renumber() {
+	for id := range n.Files {
+		n.Files[id].Number = id + 1
+	}
+
+	n.TotalFiles = len(n.Files)
+}
+
+// split the nzb into chunks whose summed file bytes stay within maxBytes
+// whole files are packed greedily in their current order and never split, a file larger than maxBytes gets a chunk of its own
+// the comment and meta data are copied to every chunk and each chunk is scanned like ScanNzbFile without touching the message-ids
+// relies on the file bytes as computed by ScanNzbFile, the nzb itself is left untouched
+func (n *Nzb) SplitBySize(maxBytes int64) []*Nzb {
+	var chunks []*Nzb
+
+	var current *Nzb
+
+	var currentBytes int64
+
+	for _, file := range n.Files {
+		if current == nil || currentBytes+file.Bytes > maxBytes {
+			current = n.emptyCopy()
+			currentBytes = 0
+
+			chunks = append(chunks, current)
+		}
+
+		current.Files = append(current.Files, file.clone())
+		currentBytes = currentBytes + file.Bytes
+	}
+
+	// the message-ids are already clean, so they are not unescaped again
+	for _, chunk := range chunks {
+		scanNzb(chunk)
+	}
+
+	return chunks
+}
+
+// returns a new nzb with copies of the comment, namespace and meta data but without any files
+func (n *Nzb) emptyCopy() *Nzb {
+	c := &Nzb{
+		Comment:      n.Comment,
+		Namespace:    n.Namespace,
+		HeadComments: append([]string(nil), n.HeadComments...),
+	}
+
+	if n.Meta != nil {
+		c.Meta = make(map[string]string, len(n.Meta))
+		for key, value := range n.Meta {
+			c.Meta[key] = value
+		}
+	}
+
+	if n.MetaMulti != nil {
+		c.MetaMulti = make(map[string][]string, len(n.MetaMulti))
+		for key, values := range n.MetaMulti {
+			c.MetaMulti[key] = append([]string(nil), values...)
+		}
+	}
+
+	return c
+}
+
+// returns a deep copy of the nzb, so the copy can be modified without affecting the original
+// files with their groups, segments and attributes as well as the meta data are copied
+func (n *Nzb) Clone() *Nzb {
+	c := n.emptyCopy()
+
+	c.TotalFiles = n.TotalFiles
+	c.Segments = n.Segments
+	c.TotalSegments = n.TotalSegments
+	c.Bytes = n.Bytes
+	c.TotalBytes = n.TotalBytes
+	c.Password = n.Password
+
+	if n.Files != nil {
+		c.Files = make(NzbFiles, len(n.Files))
+
+		for id := range n.Files {
+			c.Files[id] = n.Files[id].clone()
+		}
+	}
+
+	return c
+}
+
+// returns a copy of the file with its own groups, segments and attributes including those of the segments
+func (f *NzbFile) clone() NzbFile {
+	c := *f
+
+	c.Groups = append([]string(nil), f.Groups...)
+	c.Segments = append(NzbSegments(nil), f.Segments...)
+	c.Attrs = cloneAttrs(f.Attrs)
+
+	for id := range c.Segments {
+		c.Segments[id].Attrs = cloneAttrs(f.Segments[id].Attrs)
+	}
+
+	return c
+}
+
+// returns a copy of the attributes, nil stays nil
+func cloneAttrs(attrs map[string]string) map[string]string {
+	if attrs == nil {
+		return nil
+	}
+
+	c := make(map[string]string, len(attrs))
+	for key, value := range attrs {
+		c[key] = value
+	}
+
+	return c
+}
+
+// split the files into the content files and the par2 recovery files, both keep the order of the files
+// the returned slices are independent copies, changing them affects neither the nzb nor each other
+func (n *Nzb) PartitionByRecovery() (content, recovery NzbFiles) {
+	for id := range n.Files {
+		if n.Files[id].IsPar2() {
+			recovery = append(recovery, n.Files[id].clone())
+		} else {
+			content = append(content, n.Files[id].clone())
+		}
+	}
+
+	return content, recovery
+}
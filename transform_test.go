@@ -0,0 +1,316 @@
+package nzbparser
+
+import (
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	content := &Nzb{
+		Comment: "content",
+		Meta:    map[string]string{"title": "Release", "category": "TV"},
+		Files: []NzbFile{
+			{
+				Subject:  "[1/3] Release - \"release.rar\" yEnc (1/2)",
+				Groups:   []string{"alt.test"},
+				Segments: []NzbSegment{{Number: 2, Bytes: 200, ID: "a-2"}, {Number: 1, Bytes: 100, ID: "a-1"}},
+			},
+			{
+				Subject:  "[2/3] Release - \"release.r00\" yEnc (1/1)",
+				Groups:   []string{"alt.test"},
+				Segments: []NzbSegment{{Number: 1, Bytes: 300, ID: "b-1"}},
+			},
+		},
+	}
+	recovery := &Nzb{
+		Comment: "recovery",
+		Meta:    map[string]string{"title": "Release PAR2"},
+		Files: []NzbFile{
+			{
+				Subject:  "[3/3] Release - \"release.par2\" yEnc (1/1)",
+				Groups:   []string{"alt.test"},
+				Segments: []NzbSegment{{Number: 1, Bytes: 50, ID: "c-1"}},
+			},
+			{
+				// duplicate of a file of the first nzb
+				Subject:  "[2/3] Release - \"release.r00\" yEnc (1/1)",
+				Groups:   []string{"alt.test"},
+				Segments: []NzbSegment{{Number: 1, Bytes: 300, ID: "b-1"}},
+			},
+		},
+	}
+
+	merged := Merge(content, nil, recovery)
+
+	if len(merged.Files) != 3 {
+		t.Fatalf("Expected 3 files after merge, got %d", len(merged.Files))
+	}
+
+	for i, filename := range []string{"release.rar", "release.r00", "release.par2"} {
+		if merged.Files[i].Filename != filename {
+			t.Errorf("Expected file %d to be %q, got %q", i, filename, merged.Files[i].Filename)
+		}
+	}
+
+	if merged.Files[0].Segments[0].Number != 1 {
+		t.Error("Expected segments to be sorted")
+	}
+
+	if merged.Comment != "content" {
+		t.Errorf("Expected comment of the first nzb, got %q", merged.Comment)
+	}
+
+	if merged.Meta["title"] != "Release PAR2" || merged.Meta["category"] != "TV" {
+		t.Errorf("Unexpected merged meta %v", merged.Meta)
+	}
+
+	if merged.TotalFiles != 3 || merged.Segments != 4 || merged.Bytes != 650 {
+		t.Errorf("Unexpected totals: %d files, %d segments, %d bytes", merged.TotalFiles, merged.Segments, merged.Bytes)
+	}
+
+	// inputs are left untouched
+	if len(content.Files) != 2 || len(recovery.Files) != 2 || content.Meta["title"] != "Release" {
+		t.Error("Merge modified its inputs")
+	}
+
+	if content.Files[0].Segments[0].Number != 2 {
+		t.Error("Merge reordered the segments of its inputs")
+	}
+
+	// comment of the first non-empty nzb
+	if merged := Merge(&Nzb{}, recovery); merged.Comment != "recovery" {
+		t.Errorf("Expected comment of the first nzb with a comment, got %q", merged.Comment)
+	}
+
+	// the message-ids of parsed nzbs are not unescaped again
+	escaped := &Nzb{Files: []NzbFile{{Subject: "escaped", Segments: []NzbSegment{{Number: 1, Bytes: 1, ID: "b&amp;c@host"}}}}}
+	if merged := Merge(escaped); merged.Files[0].Segments[0].ID != "b&amp;c@host" {
+		t.Errorf("Expected the message-id to be kept, got %q", merged.Files[0].Segments[0].ID)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: "[1/4] Release - \"release.mkv\" yEnc (1/2)", Segments: []NzbSegment{{Number: 1, Bytes: 100, ID: "a-1"}, {Number: 2, Bytes: 100, ID: "a-2"}}},
+			{Subject: "[2/4] Release - \"release.nfo\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 10, ID: "b-1"}}},
+			{Subject: "[3/4] Release - \"release.par2\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 20, ID: "c-1"}}},
+			{Subject: "[4/4] Release - \"release.vol00+01.par2\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 30, ID: "d-1"}}},
+		},
+	}
+
+	ScanNzbFile(nzb)
+
+	nzb.Filter(func(file NzbFile) bool {
+		return file.Filename != "release.nfo"
+	})
+
+	if len(nzb.Files) != 3 {
+		t.Fatalf("Expected 3 files after filtering, got %d", len(nzb.Files))
+	}
+
+	if nzb.Segments != 4 || nzb.Bytes != 250 {
+		t.Errorf("Unexpected totals after filtering: %d segments, %d bytes", nzb.Segments, nzb.Bytes)
+	}
+
+	nzb.RemovePar2()
+
+	if len(nzb.Files) != 1 || nzb.Files[0].Filename != "release.mkv" {
+		t.Fatalf("Expected only release.mkv after RemovePar2, got %+v", nzb.Files)
+	}
+
+	if nzb.Segments != 2 || nzb.Bytes != 200 {
+		t.Errorf("Unexpected totals after RemovePar2: %d segments, %d bytes", nzb.Segments, nzb.Bytes)
+	}
+
+	// the subject still claims 4 files and the number isn't changed
+	if nzb.TotalFiles != 4 || nzb.Files[0].Number != 1 {
+		t.Errorf("Expected subject based total files 4 and number 1, got %d and %d", nzb.TotalFiles, nzb.Files[0].Number)
+	}
+}
+
+func TestRenumber(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: "[1/4] Release - \"a.rar\" yEnc (1/2)", Segments: []NzbSegment{{Number: 2, Bytes: 100, ID: "a-2"}, {Number: 1, Bytes: 100, ID: "a-1"}}},
+			{Subject: "[2/4] Release - \"a.par2\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 100, ID: "b-1"}}},
+			{Subject: "[4/4] Release - \"a.nfo\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 100, ID: "c-1"}}},
+		},
+	}
+	ScanNzbFile(nzb)
+
+	nzb.RemovePar2()
+
+	if nzb.Files[0].Number != 1 || nzb.Files[1].Number != 4 || nzb.TotalFiles != 4 {
+		t.Fatalf("Unexpected numbers before renumbering: %d, %d of %d", nzb.Files[0].Number, nzb.Files[1].Number, nzb.TotalFiles)
+	}
+
+	for i := 0; i < 2; i++ {
+		nzb.Renumber()
+
+		if nzb.Files[0].Number != 1 || nzb.Files[1].Number != 2 {
+			t.Errorf("Expected files numbered 1 and 2, got %d and %d", nzb.Files[0].Number, nzb.Files[1].Number)
+		}
+
+		if nzb.TotalFiles != 2 {
+			t.Errorf("Expected 2 total files, got %d", nzb.TotalFiles)
+		}
+	}
+
+	if nzb.Files[0].Segments[0].Number != 2 || nzb.Files[0].Segments[1].Number != 1 {
+		t.Error("Expected segment numbers to be untouched")
+	}
+}
+
+func TestSplitBySize(t *testing.T) {
+	nzb := &Nzb{
+		Comment: "comment",
+		Meta:    map[string]string{"title": "Release"},
+		Files: []NzbFile{
+			{Subject: "[1/4] Release - \"a.rar\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 400, ID: "a-1"}}},
+			{Subject: "[2/4] Release - \"b.rar\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 500, ID: "b-1"}}},
+			{Subject: "[3/4] Release - \"c.rar\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 1500, ID: "c-1"}}},
+			{Subject: "[4/4] Release - \"d.par2\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 100, ID: "d-1"}}},
+		},
+	}
+	ScanNzbFile(nzb)
+
+	// the message-id as parsed from d&amp;amp;1
+	nzb.Files[3].Segments[0].ID = "d&amp;1"
+
+	chunks := nzb.SplitBySize(1000)
+
+	if len(chunks) == 3 && chunks[2].Files[0].Segments[0].ID != "d&amp;1" {
+		t.Errorf("Expected the message-id to be kept, got %q", chunks[2].Files[0].Segments[0].ID)
+	}
+
+	if len(chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", len(chunks))
+	}
+
+	expected := [][]string{{"a.rar", "b.rar"}, {"c.rar"}, {"d.par2"}}
+	expectedBytes := []int64{900, 1500, 100}
+
+	for i, chunk := range chunks {
+		if len(chunk.Files) != len(expected[i]) {
+			t.Fatalf("Expected %d files in chunk %d, got %d", len(expected[i]), i, len(chunk.Files))
+		}
+
+		for j, filename := range expected[i] {
+			if chunk.Files[j].Filename != filename {
+				t.Errorf("Expected file %q in chunk %d, got %q", filename, i, chunk.Files[j].Filename)
+			}
+		}
+
+		if chunk.Bytes != expectedBytes[i] {
+			t.Errorf("Expected %d bytes in chunk %d, got %d", expectedBytes[i], i, chunk.Bytes)
+		}
+
+		// the theoretical total is still taken from the subjects
+		if chunk.TotalFiles != 4 {
+			t.Errorf("Expected 4 total files in chunk %d, got %d", i, chunk.TotalFiles)
+		}
+
+		if chunk.Comment != "comment" || chunk.Meta["title"] != "Release" {
+			t.Errorf("Expected comment and meta to be copied to chunk %d", i)
+		}
+	}
+
+	// chunks are independent of the original
+	chunks[0].Meta["title"] = "Changed"
+	chunks[0].Files[0].Segments[0].ID = "changed"
+
+	if nzb.Meta["title"] != "Release" || nzb.Files[0].Segments[0].ID != "a-1" {
+		t.Error("Expected the original nzb to be untouched")
+	}
+
+	if chunks := (&Nzb{}).SplitBySize(1000); len(chunks) != 0 {
+		t.Errorf("Expected no chunks for an empty nzb, got %d", len(chunks))
+	}
+}
+
+func TestClone(t *testing.T) {
+	nzb := &Nzb{
+		Comment:   "comment",
+		Meta:      map[string]string{"title": "Release"},
+		MetaMulti: map[string][]string{"title": {"Release"}},
+		Password:  "secret",
+		Files: []NzbFile{
+			{
+				Subject:  "[1/1] Release - \"a.rar\" yEnc (1/2)",
+				Groups:   []string{"alt.test"},
+				Segments: []NzbSegment{{Number: 1, Bytes: 100, ID: "a-1"}, {Number: 2, Bytes: 100, ID: "a-2"}},
+				Attrs:    map[string]string{"source": "indexer"},
+			},
+		},
+	}
+	ScanNzbFile(nzb)
+
+	clone := nzb.Clone()
+
+	if clone.Comment != nzb.Comment || clone.Password != nzb.Password || clone.Bytes != nzb.Bytes || clone.TotalFiles != nzb.TotalFiles {
+		t.Errorf("Expected clone to carry over all fields, got %+v", clone)
+	}
+
+	if clone.Files[0].Filename != "a.rar" || len(clone.Files[0].Segments) != 2 {
+		t.Errorf("Unexpected cloned file %+v", clone.Files[0])
+	}
+
+	clone.Files[0].Segments[0].ID = "changed"
+	clone.Files[0].Groups[0] = "alt.changed"
+	clone.Files[0].Subject = "changed"
+	clone.Files[0].Attrs["source"] = "changed"
+	clone.Meta["title"] = "Changed"
+	clone.MetaMulti["title"][0] = "Changed"
+	clone.Files = append(clone.Files, NzbFile{Subject: "new"})
+
+	if nzb.Files[0].Segments[0].ID != "a-1" {
+		t.Errorf("Expected original segment ID to be untouched, got %q", nzb.Files[0].Segments[0].ID)
+	}
+
+	if nzb.Files[0].Groups[0] != "alt.test" || nzb.Files[0].Subject != "[1/1] Release - \"a.rar\" yEnc (1/2)" || nzb.Files[0].Attrs["source"] != "indexer" {
+		t.Error("Expected original file to be untouched")
+	}
+
+	if nzb.Meta["title"] != "Release" || nzb.MetaMulti["title"][0] != "Release" {
+		t.Error("Expected original meta to be untouched")
+	}
+
+	if len(nzb.Files) != 1 {
+		t.Errorf("Expected original to keep 1 file, got %d", len(nzb.Files))
+	}
+}
+
+func TestPartitionByRecovery(t *testing.T) {
+	nzb := &Nzb{
+		Files: []NzbFile{
+			{Subject: "[1/4] Release - \"a.rar\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 100, ID: "a-1"}}},
+			{Subject: "[2/4] Release - \"a.par2\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 100, ID: "b-1"}}},
+			{Subject: "[3/4] Release - \"a.r00\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 100, ID: "c-1"}}},
+			{Subject: "[4/4] Release - \"a.vol00+01.par2\" yEnc (1/1)", Segments: []NzbSegment{{Number: 1, Bytes: 100, ID: "d-1"}}},
+		},
+	}
+	ScanNzbFile(nzb)
+
+	content, recovery := nzb.PartitionByRecovery()
+
+	if len(content) != 2 || content[0].Filename != "a.rar" || content[1].Filename != "a.r00" {
+		t.Errorf("Unexpected content files %+v", content)
+	}
+
+	if len(recovery) != 2 || recovery[0].Filename != "a.par2" || recovery[1].Filename != "a.vol00+01.par2" {
+		t.Errorf("Unexpected recovery files %+v", recovery)
+	}
+
+	// the partitions are independent of the nzb and of each other
+	content[0].Segments[0].ID = "changed"
+	content = append(content, NzbFile{Subject: "new"})
+	recovery[0].Subject = "changed"
+
+	if nzb.Files[0].Segments[0].ID != "a-1" || nzb.Files[1].Subject != "[2/4] Release - \"a.par2\" yEnc (1/1)" {
+		t.Error("Expected the nzb to be untouched")
+	}
+
+	if len(nzb.Files) != 4 || recovery[1].Filename != "a.vol00+01.par2" {
+		t.Error("Expected the partitions not to alias each other")
+	}
+}
@@ -0,0 +1,60 @@
+package nzbparser
+
+import (
+	"errors"
+	"fmt"
+)
+
+// check the nzb for structural problems which would make the written nzb file fail to download
+// reports files without segments or groups and segments without message-id or with a number below 1
+// all problems are joined into one error naming the subject of the file and the segment number, nil if none was found
+func (n *Nzb) Validate() error {
+	var errs []error
+
+	for _, file := range n.Files {
+		if len(file.Segments) == 0 {
+			errs = append(errs, fmt.Errorf("file %q: no segments", file.Subject))
+		}
+
+		if len(file.Groups) == 0 {
+			errs = append(errs, fmt.Errorf("file %q: no groups", file.Subject))
+		}
+
+		for _, segment := range file.Segments {
+			if segment.ID == "" {
+				errs = append(errs, fmt.Errorf("file %q: segment %d: empty message-id", file.Subject, segment.Number))
+			}
+
+			if segment.Number <= 0 {
+				errs = append(errs, fmt.Errorf("file %q: segment %d: invalid segment number", file.Subject, segment.Number))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// collect the recoverable problems of a scanned nzb, the messages use the same format as the errors of Validate
+func (n *Nzb) warnings() []string {
+	var warnings []string
+
+	for _, file := range n.Files {
+		if len(file.Segments) == 0 {
+			warnings = append(warnings, fmt.Sprintf("file %q: no segments", file.Subject))
+		} else if file.TotalSegments != len(file.Segments) {
+			warnings = append(warnings, fmt.Sprintf("file %q: %d of %d segments", file.Subject, len(file.Segments), file.TotalSegments))
+		}
+
+		if file.Filename == "" {
+			warnings = append(warnings, fmt.Sprintf("file %q: no filename in subject", file.Subject))
+		}
+
+		for _, segment := range file.Segments {
+			if segment.Bytes <= 0 {
+				warnings = append(warnings, fmt.Sprintf("file %q: segment %d: invalid byte count %d", file.Subject, segment.Number, segment.Bytes))
+			}
+		}
+	}
+
+	return warnings
+}
@@ -0,0 +1,78 @@
+package nzbparser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	nzb, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if err := nzb.Validate(); err != nil {
+		t.Errorf("Expected a parsed nzb to be valid, got %v", err)
+	}
+
+	invalid := &Nzb{
+		Files: []NzbFile{
+			{Subject: "no segments", Groups: []string{"alt.test"}},
+			{Subject: "no groups", Segments: []NzbSegment{{Number: 1, Bytes: 100, ID: "a-1"}}},
+			{Subject: "broken segments", Groups: []string{"alt.test"}, Segments: []NzbSegment{{Number: 3, Bytes: 100}, {Number: 0, Bytes: 100, ID: "b-0"}}},
+		},
+	}
+
+	err = invalid.Validate()
+	if err == nil {
+		t.Fatal("Expected validation error, got nil")
+	}
+
+	for _, message := range []string{
+		`file "no segments": no segments`,
+		`file "no groups": no groups`,
+		`file "broken segments": segment 3: empty message-id`,
+		`file "broken segments": segment 0: invalid segment number`,
+	} {
+		if !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected error to contain %q, got %q", message, err.Error())
+		}
+	}
+
+	if n := len(strings.Split(err.Error(), "\n")); n != 4 {
+		t.Errorf("Expected 4 joined errors, got %d", n)
+	}
+}
+
+func TestWriteWithValidation(t *testing.T) {
+	invalid := &Nzb{
+		Files: []NzbFile{
+			{Subject: "no segments", Groups: []string{"alt.test"}},
+		},
+	}
+
+	// without validation the broken nzb is written
+	if _, err := Write(invalid); err != nil {
+		t.Errorf("Expected Write to succeed without validation, got %v", err)
+	}
+
+	var buf strings.Builder
+
+	n, err := WriteToWithOptions(&buf, invalid, WriteOptions{Validate: true})
+	if err == nil || !strings.Contains(err.Error(), "no segments") {
+		t.Errorf("Expected validation error, got %v", err)
+	}
+
+	if n != 0 || buf.Len() != 0 {
+		t.Errorf("Expected nothing to be written, got %d bytes", n)
+	}
+
+	valid, err := ParseString(streamTestNZB)
+	if err != nil {
+		t.Fatalf("ParseString failed: %v", err)
+	}
+
+	if _, err := WriteWithOptions(valid, WriteOptions{Validate: true}); err != nil {
+		t.Errorf("Expected a valid nzb to be written, got %v", err)
+	}
+}